@@ -9,6 +9,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() tok.Position // where the node starts in the source
 }
 
 // Statement :
@@ -28,6 +29,7 @@ type Expression interface {
 // Program :
 type Program struct {
 	Statements []Statement
+	Lines      []string // the source the program was parsed from, for error messages
 }
 
 // TokenLiteral : Program
@@ -38,6 +40,14 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+// Pos : Program
+func (p *Program) Pos() tok.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return tok.Position{}
+}
+
 func (p *Program) String() string {
 	var str bytes.Buffer
 	for _, s := range p.Statements {
@@ -61,6 +71,11 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+// Pos : Identifier
+func (i *Identifier) Pos() tok.Position {
+	return i.Token.Pos()
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -80,6 +95,11 @@ func (i *IntegerLiteral) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+// Pos : IntegerLiteral
+func (i *IntegerLiteral) Pos() tok.Position {
+	return i.Token.Pos()
+}
+
 func (i *IntegerLiteral) String() string {
 	return i.Token.Literal
 }
@@ -99,6 +119,11 @@ func (f *FloatingLiteral) TokenLiteral() string {
 	return f.Token.Literal
 }
 
+// Pos : FloatingLiteral
+func (f *FloatingLiteral) Pos() tok.Position {
+	return f.Token.Pos()
+}
+
 func (f *FloatingLiteral) String() string {
 	return f.Token.Literal
 }
@@ -118,6 +143,11 @@ func (b *BooleanLiteral) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+// Pos : BooleanLiteral
+func (b *BooleanLiteral) Pos() tok.Position {
+	return b.Token.Pos()
+}
+
 func (b *BooleanLiteral) String() string {
 	return b.Token.Literal
 }
@@ -137,6 +167,11 @@ func (b *StringLiteral) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+// Pos : StringLiteral
+func (b *StringLiteral) Pos() tok.Position {
+	return b.Token.Pos()
+}
+
 func (b *StringLiteral) String() string {
 	return b.Token.Literal
 }
@@ -157,6 +192,11 @@ func (v *VarStatement) TokenLiteral() string {
 	return v.Token.Literal
 }
 
+// Pos : VarStatement
+func (v *VarStatement) Pos() tok.Position {
+	return v.Token.Pos()
+}
+
 func (v *VarStatement) String() string {
 	var str bytes.Buffer
 	str.WriteString(v.TokenLiteral() + " " + v.Name.String() + " = ")
@@ -168,6 +208,37 @@ func (v *VarStatement) String() string {
 
 /*-------------------------------------------------------------------*/
 
+// AssignStatement : reassignment of a name, x = value, or of an element of
+// a list or map, a[i] = value
+type AssignStatement struct {
+	Token  tok.Token  // the first token of the statement
+	Target Expression // the name or indexing expression being assigned to
+	Value  Expression
+}
+
+func (a *AssignStatement) statementNode() {}
+
+// TokenLiteral : AssignStatement
+func (a *AssignStatement) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+// Pos : AssignStatement
+func (a *AssignStatement) Pos() tok.Position {
+	return a.Token.Pos()
+}
+
+func (a *AssignStatement) String() string {
+	var str bytes.Buffer
+	str.WriteString(a.Target.String() + " = ")
+	if a.Value != nil {
+		str.WriteString(a.Value.String())
+	}
+	return str.String()
+}
+
+/*-------------------------------------------------------------------*/
+
 // ReturnStatement : Returning expressions from functions
 type ReturnStatement struct {
 	Token       tok.Token
@@ -181,6 +252,11 @@ func (r *ReturnStatement) TokenLiteral() string {
 	return r.Token.Literal
 }
 
+// Pos : ReturnStatement
+func (r *ReturnStatement) Pos() tok.Position {
+	return r.Token.Pos()
+}
+
 func (r *ReturnStatement) String() string {
 	var str bytes.Buffer
 	str.WriteString(r.TokenLiteral() + " ")
@@ -192,6 +268,79 @@ func (r *ReturnStatement) String() string {
 
 /*-------------------------------------------------------------------*/
 
+// BreakStatement : ends the innermost loop
+type BreakStatement struct {
+	Token tok.Token // the break token
+}
+
+func (b *BreakStatement) statementNode() {}
+
+// TokenLiteral : BreakStatement
+func (b *BreakStatement) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// Pos : BreakStatement
+func (b *BreakStatement) Pos() tok.Position {
+	return b.Token.Pos()
+}
+
+func (b *BreakStatement) String() string {
+	return b.Token.Literal
+}
+
+/*-------------------------------------------------------------------*/
+
+// ContinueStatement : skips to the next iteration of the innermost loop
+type ContinueStatement struct {
+	Token tok.Token // the continue token
+}
+
+func (c *ContinueStatement) statementNode() {}
+
+// TokenLiteral : ContinueStatement
+func (c *ContinueStatement) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+// Pos : ContinueStatement
+func (c *ContinueStatement) Pos() tok.Position {
+	return c.Token.Pos()
+}
+
+func (c *ContinueStatement) String() string {
+	return c.Token.Literal
+}
+
+/*-------------------------------------------------------------------*/
+
+// ImportStatement : loads the module at Path and binds its namespace to Name,
+// which is the alias given with "as", or else the file name of the module
+type ImportStatement struct {
+	Token   tok.Token // the import token
+	Path    string
+	Name    *Identifier
+	Aliased bool // whether Name was given with "as"
+}
+
+func (is *ImportStatement) statementNode() {}
+
+// TokenLiteral : ImportStatement
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+
+// Pos : ImportStatement
+func (is *ImportStatement) Pos() tok.Position {
+	return is.Token.Pos()
+}
+
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " \"" + is.Path + "\" as " + is.Name.String()
+}
+
+/*-------------------------------------------------------------------*/
+
 // ExpressionStatement : Expressions used as statements
 type ExpressionStatement struct {
 	Token      tok.Token // holds the first token in the expression-statement
@@ -205,6 +354,11 @@ func (e *ExpressionStatement) TokenLiteral() string {
 	return e.Token.Literal
 }
 
+// Pos : ExpressionStatement
+func (e *ExpressionStatement) Pos() tok.Position {
+	return e.Token.Pos()
+}
+
 func (e *ExpressionStatement) String() string {
 	if e.Expression != nil {
 		return e.Expression.String()
@@ -228,6 +382,11 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+// Pos : PrefixExpression
+func (pe *PrefixExpression) Pos() tok.Position {
+	return pe.Token.Pos()
+}
+
 func (pe *PrefixExpression) String() string {
 	var str bytes.Buffer
 	str.WriteString("(" + pe.Operator + " " + pe.RightExpression.String() + ")")
@@ -251,6 +410,11 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+// Pos : InfixExpression
+func (ie *InfixExpression) Pos() tok.Position {
+	return ie.Token.Pos()
+}
+
 func (ie *InfixExpression) String() string {
 	var str bytes.Buffer
 	str.WriteString("(" + ie.LeftExpression.String() + " " + ie.Operator + " " + ie.RightExpression.String() + ")")
@@ -274,6 +438,11 @@ func (ife *IfExpression) TokenLiteral() string {
 	return ife.Token.Literal
 }
 
+// Pos : IfExpression
+func (ife *IfExpression) Pos() tok.Position {
+	return ife.Token.Pos()
+}
+
 func (ife *IfExpression) String() string {
 	var str bytes.Buffer
 	str.WriteString("\nIF (begin) :")
@@ -305,6 +474,11 @@ func (b *Block) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+// Pos : Block
+func (b *Block) Pos() tok.Position {
+	return b.Token.Pos()
+}
+
 func (b *Block) String() string {
 	var str bytes.Buffer
 	for _, v := range b.Statements {
@@ -329,6 +503,11 @@ func (f *FunctionExpression) TokenLiteral() string {
 	return f.Token.Literal
 }
 
+// Pos : FunctionExpression
+func (f *FunctionExpression) Pos() tok.Position {
+	return f.Token.Pos()
+}
+
 func (f *FunctionExpression) String() string {
 	var str bytes.Buffer
 	str.WriteString("\nFUNC (begin):")
@@ -358,6 +537,11 @@ func (fc *FunctionCallExpression) TokenLiteral() string {
 	return fc.Token.Literal
 }
 
+// Pos : FunctionCallExpression
+func (fc *FunctionCallExpression) Pos() tok.Position {
+	return fc.Token.Pos()
+}
+
 func (fc *FunctionCallExpression) String() string {
 	var str bytes.Buffer
 	str.WriteString(fc.Function.String())
@@ -384,6 +568,11 @@ func (l *LoopExpression) TokenLiteral() string {
 	return l.Token.Literal
 }
 
+// Pos : LoopExpression
+func (l *LoopExpression) Pos() tok.Position {
+	return l.Token.Pos()
+}
+
 func (l *LoopExpression) String() string {
 	var str bytes.Buffer
 	str.WriteString("\nLOOP (begin) :")
@@ -396,6 +585,78 @@ func (l *LoopExpression) String() string {
 
 /*-------------------------------------------------------------------*/
 
+// ForEachExpression : loops running once for each element of a list,
+// character of a string or key of a map
+type ForEachExpression struct {
+	Token      tok.Token   // holds the [l] token
+	Key        *Identifier // bound to the index or key; nil if not asked for
+	Value      *Identifier // bound to the element, or to the key when iterating over a map without Key
+	Collection Expression
+	LoopBody   *Block
+}
+
+func (fe *ForEachExpression) expressionNode() {}
+
+// TokenLiteral : ForEachExpression
+func (fe *ForEachExpression) TokenLiteral() string {
+	return fe.Token.Literal
+}
+
+// Pos : ForEachExpression
+func (fe *ForEachExpression) Pos() tok.Position {
+	return fe.Token.Pos()
+}
+
+func (fe *ForEachExpression) String() string {
+	var str bytes.Buffer
+	str.WriteString("\nFOR EACH (begin) :")
+	str.WriteString("\nVARIABLES : ")
+	if fe.Key != nil {
+		str.WriteString(fe.Key.String() + ", ")
+	}
+	str.WriteString(fe.Value.String())
+	str.WriteString("\nIN : " + fe.Collection.String())
+	str.WriteString("\nBODY (loop) :\n")
+	str.WriteString(fe.LoopBody.String())
+	str.WriteString("\nFOR EACH (end)")
+	return str.String()
+}
+
+/*-------------------------------------------------------------------*/
+
+// TryExpression : runs TryBody, and CatchBody with the error bound to ErrName
+// if a runtime error happens in TryBody
+type TryExpression struct {
+	Token     tok.Token // holds the [t] token
+	TryBody   *Block
+	ErrName   *Identifier
+	CatchBody *Block
+}
+
+func (te *TryExpression) expressionNode() {}
+
+// TokenLiteral : TryExpression
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+
+// Pos : TryExpression
+func (te *TryExpression) Pos() tok.Position {
+	return te.Token.Pos()
+}
+
+func (te *TryExpression) String() string {
+	var str bytes.Buffer
+	str.WriteString("\nTRY (begin) :\n")
+	str.WriteString(te.TryBody.String())
+	str.WriteString("\nCATCH (" + te.ErrName.String() + ") :\n")
+	str.WriteString(te.CatchBody.String())
+	str.WriteString("\nTRY (end)")
+	return str.String()
+}
+
+/*-------------------------------------------------------------------*/
+
 // Array : To represent array literals
 type Array struct {
 	Token    tok.Token
@@ -409,6 +670,11 @@ func (a *Array) TokenLiteral() string {
 	return a.Token.Literal
 }
 
+// Pos : Array
+func (a *Array) Pos() tok.Position {
+	return a.Token.Pos()
+}
+
 func (a *Array) String() string {
 	var str bytes.Buffer
 	str.WriteString("Array : [ ")
@@ -421,6 +687,37 @@ func (a *Array) String() string {
 
 /*-------------------------------------------------------------------*/
 
+// Map : To represent map literals, {key = value, ...}
+type Map struct {
+	Token  tok.Token // the { token
+	Keys   []Expression
+	Values []Expression // Values[i] is the value bound to Keys[i]
+}
+
+func (m *Map) expressionNode() {}
+
+// TokenLiteral : Map
+func (m *Map) TokenLiteral() string {
+	return m.Token.Literal
+}
+
+// Pos : Map
+func (m *Map) Pos() tok.Position {
+	return m.Token.Pos()
+}
+
+func (m *Map) String() string {
+	var str bytes.Buffer
+	str.WriteString("Map : { ")
+	for k := range m.Keys {
+		str.WriteString(m.Keys[k].String() + " = " + m.Values[k].String() + ", ")
+	}
+	str.WriteString(" }")
+	return str.String()
+}
+
+/*-------------------------------------------------------------------*/
+
 // ArrayIndexExpression : expressions extracting a value at a particular
 // index from an array
 type ArrayIndexExpression struct {
@@ -439,6 +736,11 @@ func (ain *ArrayIndexExpression) TokenLiteral() string {
 	return ain.Token.Literal
 }
 
+// Pos : ArrayIndexExpression
+func (ain *ArrayIndexExpression) Pos() tok.Position {
+	return ain.Token.Pos()
+}
+
 func (ain *ArrayIndexExpression) String() string {
 	var str bytes.Buffer
 	str.WriteString("(")
@@ -450,3 +752,29 @@ func (ain *ArrayIndexExpression) String() string {
 }
 
 /*-------------------------------------------------------------------*/
+
+// MemberExpression : a binding of a module, read through the namespace the
+// module was imported as, lib.name
+type MemberExpression struct {
+	Token          tok.Token  // the . token
+	LeftExpression Expression // the namespace, or something that evaluates to one
+	Member         *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+
+// TokenLiteral : MemberExpression
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+// Pos : MemberExpression
+func (me *MemberExpression) Pos() tok.Position {
+	return me.Token.Pos()
+}
+
+func (me *MemberExpression) String() string {
+	return me.LeftExpression.String() + "." + me.Member.String()
+}
+
+/*-------------------------------------------------------------------*/
@@ -0,0 +1,458 @@
+package collast
+
+import (
+	"bufio"
+	"bytes"
+	tok "colon/coltok"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+)
+
+// EncodingVersion : the version of the binary encoding of syntax trees. It
+// changes with the encoding and with the nodes, so that trees encoded by
+// another version of colon can be told apart and rejected.
+const EncodingVersion = 2
+
+// Every node is encoded as a tag followed by its token and its fields in
+// declaration order. Integers are varints, strings and lists are prefixed
+// with their length, and an absent node is encoded as tagNil.
+const (
+	tagNil byte = iota
+	tagProgram
+	tagIdentifier
+	tagIntegerLiteral
+	tagFloatingLiteral
+	tagBooleanLiteral
+	tagStringLiteral
+	tagVarStatement
+	tagAssignStatement
+	tagReturnStatement
+	tagBreakStatement
+	tagContinueStatement
+	tagExpressionStatement
+	tagPrefixExpression
+	tagInfixExpression
+	tagIfExpression
+	tagBlock
+	tagFunctionExpression
+	tagFunctionCallExpression
+	tagLoopExpression
+	tagForEachExpression
+	tagTryExpression
+	tagArray
+	tagMap
+	tagArrayIndexExpression
+	tagImportStatement
+	tagMemberExpression
+)
+
+// Encode : writes the binary encoding of a program, node positions included
+func Encode(w io.Writer, program *Program) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.node(program)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) byte(b byte) {
+	if e.err == nil {
+		e.err = e.w.WriteByte(b)
+	}
+}
+
+func (e *encoder) int(i int64) {
+	n := binary.PutVarint(e.buf[:], i)
+	if e.err == nil {
+		_, e.err = e.w.Write(e.buf[:n])
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.int(int64(len(s)))
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+func (e *encoder) token(t tok.Token) {
+	e.int(int64(t.TokType))
+	e.string(t.Literal)
+	e.int(int64(t.Line))
+	e.int(int64(t.Column))
+}
+
+func (e *encoder) statements(statements []Statement) {
+	e.int(int64(len(statements)))
+	for _, s := range statements {
+		e.node(s)
+	}
+}
+
+func (e *encoder) expressions(expressions []Expression) {
+	e.int(int64(len(expressions)))
+	for _, x := range expressions {
+		e.node(x)
+	}
+}
+
+func (e *encoder) node(n Node) {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		e.byte(tagNil)
+		return
+	}
+	switch n := n.(type) {
+	case *Program:
+		e.byte(tagProgram)
+		e.statements(n.Statements)
+	case *Identifier:
+		e.byte(tagIdentifier)
+		e.token(n.Token)
+		e.string(n.Value)
+	case *IntegerLiteral:
+		e.byte(tagIntegerLiteral)
+		e.token(n.Token)
+		e.int(n.Value)
+	case *FloatingLiteral:
+		e.byte(tagFloatingLiteral)
+		e.token(n.Token)
+		e.int(int64(math.Float64bits(n.Value)))
+	case *BooleanLiteral:
+		e.byte(tagBooleanLiteral)
+		e.token(n.Token)
+		if n.Value {
+			e.byte(1)
+		} else {
+			e.byte(0)
+		}
+	case *StringLiteral:
+		e.byte(tagStringLiteral)
+		e.token(n.Token)
+		e.string(n.Value)
+	case *VarStatement:
+		e.byte(tagVarStatement)
+		e.token(n.Token)
+		e.node(n.Name)
+		e.node(n.Value)
+	case *AssignStatement:
+		e.byte(tagAssignStatement)
+		e.token(n.Token)
+		e.node(n.Target)
+		e.node(n.Value)
+	case *ReturnStatement:
+		e.byte(tagReturnStatement)
+		e.token(n.Token)
+		e.node(n.ReturnValue)
+	case *BreakStatement:
+		e.byte(tagBreakStatement)
+		e.token(n.Token)
+	case *ContinueStatement:
+		e.byte(tagContinueStatement)
+		e.token(n.Token)
+	case *ExpressionStatement:
+		e.byte(tagExpressionStatement)
+		e.token(n.Token)
+		e.node(n.Expression)
+	case *PrefixExpression:
+		e.byte(tagPrefixExpression)
+		e.token(n.Token)
+		e.string(n.Operator)
+		e.node(n.RightExpression)
+	case *InfixExpression:
+		e.byte(tagInfixExpression)
+		e.token(n.Token)
+		e.string(n.Operator)
+		e.node(n.LeftExpression)
+		e.node(n.RightExpression)
+	case *IfExpression:
+		e.byte(tagIfExpression)
+		e.token(n.Token)
+		e.node(n.Condition)
+		e.node(n.IfBody)
+		e.node(n.ElseBody)
+	case *Block:
+		e.byte(tagBlock)
+		e.token(n.Token)
+		e.statements(n.Statements)
+	case *FunctionExpression:
+		e.byte(tagFunctionExpression)
+		e.token(n.Token)
+		e.int(int64(len(n.Params)))
+		for _, p := range n.Params {
+			e.node(p)
+		}
+		e.node(n.FuncBody)
+	case *FunctionCallExpression:
+		e.byte(tagFunctionCallExpression)
+		e.token(n.Token)
+		e.node(n.Function)
+		e.expressions(n.Arguments)
+	case *LoopExpression:
+		e.byte(tagLoopExpression)
+		e.token(n.Token)
+		e.node(n.Condition)
+		e.node(n.LoopBody)
+	case *ForEachExpression:
+		e.byte(tagForEachExpression)
+		e.token(n.Token)
+		e.node(n.Key)
+		e.node(n.Value)
+		e.node(n.Collection)
+		e.node(n.LoopBody)
+	case *TryExpression:
+		e.byte(tagTryExpression)
+		e.token(n.Token)
+		e.node(n.TryBody)
+		e.node(n.ErrName)
+		e.node(n.CatchBody)
+	case *Array:
+		e.byte(tagArray)
+		e.token(n.Token)
+		e.expressions(n.Elements)
+	case *Map:
+		e.byte(tagMap)
+		e.token(n.Token)
+		e.expressions(n.Keys)
+		e.expressions(n.Values)
+	case *ArrayIndexExpression:
+		e.byte(tagArrayIndexExpression)
+		e.token(n.Token)
+		e.node(n.LeftExpression)
+		e.node(n.Index)
+	case *ImportStatement:
+		e.byte(tagImportStatement)
+		e.token(n.Token)
+		e.string(n.Path)
+		e.node(n.Name)
+		if n.Aliased {
+			e.byte(1)
+		} else {
+			e.byte(0)
+		}
+	case *MemberExpression:
+		e.byte(tagMemberExpression)
+		e.token(n.Token)
+		e.node(n.LeftExpression)
+		e.node(n.Member)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode node of type %T", n)
+		}
+	}
+}
+
+// Decode : reads a program written by Encode
+func Decode(r io.Reader) (program *Program, err error) {
+	// the whole input is read first, so that lengths can be checked
+	// against what is left of it before anything is allocated
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{r: bytes.NewReader(data)}
+	// malformed input shows up as a node of the wrong type in some field
+	defer func() {
+		if r := recover(); r != nil {
+			program, err = nil, fmt.Errorf("malformed syntax tree encoding: %v", r)
+		}
+	}()
+	program, ok := d.node().(*Program)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !ok {
+		return nil, fmt.Errorf("malformed syntax tree encoding: no program")
+	}
+	return program, nil
+}
+
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	panic(err)
+}
+
+func (d *decoder) byte() byte {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		d.fail(err)
+	}
+	return b
+}
+
+func (d *decoder) int() int64 {
+	i, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return i
+}
+
+// length : reads the length of a string or list, which can be no longer
+// than what is left of the input
+func (d *decoder) length() int {
+	n := d.int()
+	if n < 0 || n > int64(d.r.Len()) {
+		d.fail(fmt.Errorf("invalid length %d", n))
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	buf := make([]byte, d.length())
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.fail(err)
+	}
+	return string(buf)
+}
+
+func (d *decoder) token() tok.Token {
+	return tok.Token{
+		TokType: tok.TokenType(d.int()),
+		Literal: d.string(),
+		Line:    int(d.int()),
+		Column:  int(d.int()),
+	}
+}
+
+func (d *decoder) statements() []Statement {
+	n := d.length()
+	statements := []Statement{}
+	for k := 0; k < n; k++ {
+		statements = append(statements, d.statement())
+	}
+	return statements
+}
+
+func (d *decoder) expressions() []Expression {
+	n := d.length()
+	expressions := []Expression{}
+	for k := 0; k < n; k++ {
+		expressions = append(expressions, d.expression())
+	}
+	return expressions
+}
+
+func (d *decoder) statement() Statement {
+	if n := d.node(); n != nil {
+		return n.(Statement)
+	}
+	return nil
+}
+
+func (d *decoder) expression() Expression {
+	if n := d.node(); n != nil {
+		return n.(Expression)
+	}
+	return nil
+}
+
+func (d *decoder) block() *Block {
+	if n := d.node(); n != nil {
+		return n.(*Block)
+	}
+	return nil
+}
+
+func (d *decoder) identifier() *Identifier {
+	if n := d.node(); n != nil {
+		return n.(*Identifier)
+	}
+	return nil
+}
+
+func (d *decoder) node() Node {
+	tag := d.byte()
+	switch tag {
+	case tagNil:
+		return nil
+	case tagProgram:
+		return &Program{Statements: d.statements()}
+	case tagIdentifier:
+		return &Identifier{Token: d.token(), Value: d.string()}
+	case tagIntegerLiteral:
+		return &IntegerLiteral{Token: d.token(), Value: d.int()}
+	case tagFloatingLiteral:
+		return &FloatingLiteral{Token: d.token(), Value: math.Float64frombits(uint64(d.int()))}
+	case tagBooleanLiteral:
+		return &BooleanLiteral{Token: d.token(), Value: d.byte() == 1}
+	case tagStringLiteral:
+		return &StringLiteral{Token: d.token(), Value: d.string()}
+	case tagVarStatement:
+		return &VarStatement{Token: d.token(), Name: d.identifier(), Value: d.expression()}
+	case tagAssignStatement:
+		return &AssignStatement{Token: d.token(), Target: d.expression(), Value: d.expression()}
+	case tagReturnStatement:
+		return &ReturnStatement{Token: d.token(), ReturnValue: d.expression()}
+	case tagBreakStatement:
+		return &BreakStatement{Token: d.token()}
+	case tagContinueStatement:
+		return &ContinueStatement{Token: d.token()}
+	case tagExpressionStatement:
+		return &ExpressionStatement{Token: d.token(), Expression: d.expression()}
+	case tagPrefixExpression:
+		return &PrefixExpression{Token: d.token(), Operator: d.string(), RightExpression: d.expression()}
+	case tagInfixExpression:
+		return &InfixExpression{
+			Token:           d.token(),
+			Operator:        d.string(),
+			LeftExpression:  d.expression(),
+			RightExpression: d.expression(),
+		}
+	case tagIfExpression:
+		return &IfExpression{Token: d.token(), Condition: d.expression(), IfBody: d.block(), ElseBody: d.block()}
+	case tagBlock:
+		return &Block{Token: d.token(), Statements: d.statements()}
+	case tagFunctionExpression:
+		fe := &FunctionExpression{Token: d.token(), Params: []*Identifier{}}
+		n := d.length()
+		for k := 0; k < n; k++ {
+			fe.Params = append(fe.Params, d.identifier())
+		}
+		fe.FuncBody = d.block()
+		return fe
+	case tagFunctionCallExpression:
+		return &FunctionCallExpression{Token: d.token(), Function: d.expression(), Arguments: d.expressions()}
+	case tagLoopExpression:
+		return &LoopExpression{Token: d.token(), Condition: d.expression(), LoopBody: d.block()}
+	case tagForEachExpression:
+		return &ForEachExpression{
+			Token:      d.token(),
+			Key:        d.identifier(),
+			Value:      d.identifier(),
+			Collection: d.expression(),
+			LoopBody:   d.block(),
+		}
+	case tagTryExpression:
+		return &TryExpression{Token: d.token(), TryBody: d.block(), ErrName: d.identifier(), CatchBody: d.block()}
+	case tagArray:
+		return &Array{Token: d.token(), Elements: d.expressions()}
+	case tagMap:
+		return &Map{Token: d.token(), Keys: d.expressions(), Values: d.expressions()}
+	case tagArrayIndexExpression:
+		return &ArrayIndexExpression{Token: d.token(), LeftExpression: d.expression(), Index: d.expression()}
+	case tagImportStatement:
+		return &ImportStatement{Token: d.token(), Path: d.string(), Name: d.identifier(), Aliased: d.byte() == 1}
+	case tagMemberExpression:
+		return &MemberExpression{Token: d.token(), LeftExpression: d.expression(), Member: d.identifier()}
+	}
+	d.fail(fmt.Errorf("unknown node tag %d", tag))
+	return nil
+}
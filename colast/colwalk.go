@@ -0,0 +1,93 @@
+package collast
+
+// Inspect : calls visit for node and then, if visit returns true, inspects
+// each of the nodes node is made of, in the order they appear in the source.
+// Absent nodes, such as the else body of an if without one, are skipped.
+func Inspect(node Node, visit func(Node) bool) {
+	if !visit(node) {
+		return
+	}
+	inspectExpression := func(x Expression) {
+		if x != nil {
+			Inspect(x, visit)
+		}
+	}
+	inspectBlock := func(b *Block) {
+		if b != nil {
+			Inspect(b, visit)
+		}
+	}
+	inspectIdentifier := func(i *Identifier) {
+		if i != nil {
+			Inspect(i, visit)
+		}
+	}
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, visit)
+		}
+	case *Block:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, visit)
+		}
+	case *VarStatement:
+		inspectIdentifier(node.Name)
+		inspectExpression(node.Value)
+	case *AssignStatement:
+		inspectExpression(node.Target)
+		inspectExpression(node.Value)
+	case *ImportStatement:
+		inspectIdentifier(node.Name)
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue)
+	case *ExpressionStatement:
+		inspectExpression(node.Expression)
+	case *PrefixExpression:
+		inspectExpression(node.RightExpression)
+	case *InfixExpression:
+		inspectExpression(node.LeftExpression)
+		inspectExpression(node.RightExpression)
+	case *IfExpression:
+		inspectExpression(node.Condition)
+		inspectBlock(node.IfBody)
+		inspectBlock(node.ElseBody)
+	case *FunctionExpression:
+		for _, param := range node.Params {
+			inspectIdentifier(param)
+		}
+		inspectBlock(node.FuncBody)
+	case *FunctionCallExpression:
+		inspectExpression(node.Function)
+		for _, arg := range node.Arguments {
+			inspectExpression(arg)
+		}
+	case *LoopExpression:
+		inspectExpression(node.Condition)
+		inspectBlock(node.LoopBody)
+	case *ForEachExpression:
+		inspectIdentifier(node.Key)
+		inspectIdentifier(node.Value)
+		inspectExpression(node.Collection)
+		inspectBlock(node.LoopBody)
+	case *TryExpression:
+		inspectBlock(node.TryBody)
+		inspectIdentifier(node.ErrName)
+		inspectBlock(node.CatchBody)
+	case *Array:
+		for _, element := range node.Elements {
+			inspectExpression(element)
+		}
+	case *Map:
+		for k := range node.Keys {
+			inspectExpression(node.Keys[k])
+			inspectExpression(node.Values[k])
+		}
+	case *ArrayIndexExpression:
+		inspectExpression(node.LeftExpression)
+		inspectExpression(node.Index)
+	case *MemberExpression:
+		inspectExpression(node.LeftExpression)
+		inspectIdentifier(node.Member)
+	}
+}
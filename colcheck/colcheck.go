@@ -0,0 +1,476 @@
+package colcheck
+
+import (
+	ast "colon/colast"
+	evl "colon/coleval"
+	obj "colon/colobj"
+	par "colon/colparc"
+	"fmt"
+	"sort"
+)
+
+// Severity : how serious a problem found by the checker is
+type Severity string
+
+const (
+	// ERROR : code that fails with a runtime error whenever it runs
+	ERROR Severity = "Error"
+	// WARNING : code that runs, but probably not as intended
+	WARNING Severity = "Warning"
+)
+
+// Diagnostic : a problem found by the checker. Line and Column are 1-based,
+// Source holds the text of the offending line.
+type Diagnostic struct {
+	Severity Severity
+	Line     int
+	Column   int
+	Msg      string
+	Source   string
+}
+
+func (d *Diagnostic) Error() string {
+	msg := fmt.Sprintf("%s on line %d, column %d : %s", d.Severity, d.Line, d.Column, d.Msg)
+	if d.Source != "" {
+		msg += "\n\n" + par.PointAt(d.Source, d.Column)
+	}
+	return msg
+}
+
+// arity of a binding whose value is not known to be a function
+const unknownArity = -1
+
+// binding : a name declared in a scope
+type binding struct {
+	name     *ast.Identifier         // where the name is declared, nil for globals
+	arity    int                     // number of parameters, if the name is bound to a function literal
+	function *ast.FunctionExpression // the function literal the name is bound to, if known
+}
+
+// scope : the names declared in a function, or at the top level. Like the
+// evaluator, the checker gives blocks no scope of their own.
+type scope struct {
+	parent    *scope
+	names     map[string]*binding
+	functions []*ast.FunctionExpression // function literals to check once the scope is complete
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, names: map[string]*binding{}}
+}
+
+// lookup : the nearest binding of a name
+func (s *scope) lookup(name string) (*binding, bool) {
+	for ; s != nil; s = s.parent {
+		if b, ok := s.names[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Checker : finds problems in a program without running it: undeclared
+// names, calls with the wrong number of arguments, unreachable code,
+// shadowed names and operators applied to literals of the wrong types.
+//
+// The bodies of functions are checked after the rest of the code they are
+// defined in, so that they can use names declared after them, as they can
+// when they are called.
+type Checker struct {
+	ev          *evl.Evaluator
+	globals     map[string]*binding
+	reassigned  map[string]bool // names rebound with "name = ...", whose arity cannot be trusted
+	lines       []string        // source lines of the program being checked
+	diagnostics []*Diagnostic
+	resolved    map[*ast.Identifier]*binding // the binding each name in the program refers to
+}
+
+// NewChecker : creates a checker for code run by ev with the names bound in
+// globals already declared. globals may be nil.
+func NewChecker(ev *evl.Evaluator, globals *obj.Env) *Checker {
+	c := &Checker{ev: ev, globals: map[string]*binding{}}
+	if globals != nil {
+		for _, name := range globals.Names() {
+			value, _ := globals.Get(name)
+			c.globals[name] = &binding{arity: arityOf(value)}
+		}
+	}
+	return c
+}
+
+// arityOf : the number of parameters of a colon function
+func arityOf(value obj.Object) int {
+	if funct, ok := value.(*obj.Function); ok {
+		return len(funct.Parameters)
+	}
+	return unknownArity
+}
+
+// Check : checks a program, returning the problems found in the order they
+// appear in the source
+func (c *Checker) Check(program *ast.Program) []*Diagnostic {
+	c.diagnostics = []*Diagnostic{}
+	c.lines = program.Lines
+	c.reassigned = map[string]bool{}
+	c.resolved = map[*ast.Identifier]*binding{}
+	collectReassigned(program, c.reassigned)
+
+	// code at the top level runs in the same env as the globals
+	top := newScope(nil)
+	for name, b := range c.globals {
+		top.names[name] = b
+	}
+	c.checkStatements(program.Statements, top)
+	c.checkFunctions(top)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return c.diagnostics
+}
+
+// Definition : the identifier that declares the name ident refers to in the
+// program last checked, or nil for builtins, globals and undeclared names
+func (c *Checker) Definition(ident *ast.Identifier) *ast.Identifier {
+	if b, ok := c.resolved[ident]; ok {
+		return b.name
+	}
+	return nil
+}
+
+// FunctionOf : the function literal the name ident refers to is declared
+// with, or nil if it is not known to be one
+func (c *Checker) FunctionOf(ident *ast.Identifier) *ast.FunctionExpression {
+	if b, ok := c.resolved[ident]; ok {
+		return b.function
+	}
+	return nil
+}
+
+func (c *Checker) report(severity Severity, node ast.Node, format string, args ...interface{}) {
+	pos := node.Pos()
+	c.diagnostics = append(c.diagnostics, &Diagnostic{
+		Severity: severity,
+		Line:     pos.Line + 1,
+		Column:   pos.Column + 1,
+		Msg:      fmt.Sprintf(format, args...),
+		Source:   par.SourceLine(c.lines, pos.Line),
+	})
+}
+
+// checkFunctions : checks the bodies of the function literals defined in a
+// scope, each in a scope of its own
+func (c *Checker) checkFunctions(s *scope) {
+	for k := 0; k < len(s.functions); k++ {
+		fe := s.functions[k]
+		inner := newScope(s)
+		for _, param := range fe.Params {
+			c.declare(param, inner, &binding{arity: unknownArity})
+		}
+		c.checkStatements(fe.FuncBody.Statements, inner)
+		c.checkFunctions(inner)
+	}
+}
+
+// declare : declares a name in a scope, warning if it hides a name declared
+// around the scope or a builtin
+func (c *Checker) declare(name *ast.Identifier, s *scope, b *binding) {
+	if _, ok := s.names[name.Value]; !ok {
+		if outer, ok := s.parent.lookup(name.Value); ok {
+			if outer.name != nil {
+				c.report(WARNING, name, "%q shadows the variable declared on line %d", name.Value, outer.name.Pos().Line+1)
+			} else {
+				c.report(WARNING, name, "%q shadows the global variable of the same name", name.Value)
+			}
+		} else if c.isBuiltIn(name.Value) {
+			c.report(WARNING, name, "%q shadows the builtin of the same name", name.Value)
+		}
+	}
+	b.name = name
+	s.names[name.Value] = b
+	c.resolved[name] = b
+}
+
+func (c *Checker) isBuiltIn(name string) bool {
+	_, ok := c.ev.BuiltIn(name)
+	return ok
+}
+
+// checkStatements : checks a list of statements, warning about the first
+// statement that follows one which always leaves the list
+func (c *Checker) checkStatements(statements []ast.Statement, s *scope) {
+	var exit ast.Statement
+	for _, stmt := range statements {
+		if exit != nil {
+			c.report(WARNING, stmt, "unreachable code after %s", describeExit(exit))
+			exit = nil
+		}
+		c.checkStatement(stmt, s)
+		if c.exits(stmt) {
+			exit = stmt
+		}
+	}
+}
+
+func describeExit(stmt ast.Statement) string {
+	switch stmt.(type) {
+	case *ast.ReturnStatement:
+		return "r:"
+	case *ast.BreakStatement:
+		return "break"
+	case *ast.ContinueStatement:
+		return "continue"
+	}
+	if _, ok := stmt.(*ast.ExpressionStatement).Expression.(*ast.IfExpression); ok {
+		return "an i: all of whose branches exit"
+	}
+	return "throw"
+}
+
+// exits : whether a statement always leaves the statements it is part of,
+// by returning, breaking out of or continuing a loop, or throwing
+func (c *Checker) exits(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	case *ast.ExpressionStatement:
+		switch x := stmt.Expression.(type) {
+		case *ast.FunctionCallExpression:
+			callee, ok := x.Function.(*ast.Identifier)
+			return ok && callee.Value == "throw" && c.isBuiltIn("throw")
+		case *ast.IfExpression:
+			return x.ElseBody != nil && c.blockExits(x.IfBody) && c.blockExits(x.ElseBody)
+		}
+	}
+	return false
+}
+
+func (c *Checker) blockExits(block *ast.Block) bool {
+	for _, stmt := range block.Statements {
+		if c.exits(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checker) checkStatement(stmt ast.Statement, s *scope) {
+	switch stmt := stmt.(type) {
+	case *ast.VarStatement:
+		c.checkExpression(stmt.Value, s)
+		b := &binding{arity: unknownArity}
+		if !c.reassigned[stmt.Name.Value] {
+			b = c.valueOf(stmt.Value, s)
+		}
+		c.declare(stmt.Name, s, b)
+	case *ast.ImportStatement:
+		c.declare(stmt.Name, s, &binding{arity: unknownArity})
+	case *ast.AssignStatement:
+		c.checkExpression(stmt.Value, s)
+		if name, ok := stmt.Target.(*ast.Identifier); ok {
+			if b, ok := s.lookup(name.Value); ok {
+				c.resolved[name] = b
+			} else {
+				c.report(ERROR, name, "variable %q not declared. Use 'v: %s = ...' to declare it", name.Value, name.Value)
+			}
+		} else {
+			c.checkExpression(stmt.Target, s)
+		}
+	case *ast.ReturnStatement:
+		c.checkExpression(stmt.ReturnValue, s)
+	case *ast.ExpressionStatement:
+		c.checkExpression(stmt.Expression, s)
+	}
+}
+
+// checkExpression : checks an expression and returns its type, or "" if
+// its type cannot be known without running it
+func (c *Checker) checkExpression(x ast.Expression, s *scope) obj.ObjectType {
+	switch x := x.(type) {
+	case *ast.IntegerLiteral:
+		return obj.INTEGER
+	case *ast.FloatingLiteral:
+		return obj.FLOATING
+	case *ast.StringLiteral:
+		return obj.STRING
+	case *ast.BooleanLiteral:
+		return obj.BOOLEAN
+	case *ast.Identifier:
+		if b, ok := s.lookup(x.Value); ok {
+			c.resolved[x] = b
+		} else if !c.isBuiltIn(x.Value) {
+			c.report(ERROR, x, "variable %q is not declared before it is used", x.Value)
+		}
+	case *ast.Array:
+		for _, element := range x.Elements {
+			c.checkExpression(element, s)
+		}
+		return obj.LIST
+	case *ast.Map:
+		for k := range x.Keys {
+			c.checkExpression(x.Keys[k], s)
+			c.checkExpression(x.Values[k], s)
+		}
+		return obj.MAP
+	case *ast.PrefixExpression:
+		return c.checkPrefix(x, c.checkExpression(x.RightExpression, s))
+	case *ast.InfixExpression:
+		left := c.checkExpression(x.LeftExpression, s)
+		right := c.checkExpression(x.RightExpression, s)
+		return c.checkInfix(x, left, right)
+	case *ast.ArrayIndexExpression:
+		c.checkExpression(x.LeftExpression, s)
+		c.checkExpression(x.Index, s)
+	case *ast.MemberExpression:
+		// the members of a module are only known once it has run
+		c.checkExpression(x.LeftExpression, s)
+	case *ast.FunctionExpression:
+		s.functions = append(s.functions, x)
+		return obj.FUNCTION
+	case *ast.FunctionCallExpression:
+		c.checkCall(x, s)
+	case *ast.IfExpression:
+		c.checkExpression(x.Condition, s)
+		c.checkStatements(x.IfBody.Statements, s)
+		if x.ElseBody != nil {
+			c.checkStatements(x.ElseBody.Statements, s)
+		}
+	case *ast.LoopExpression:
+		c.checkExpression(x.Condition, s)
+		c.checkStatements(x.LoopBody.Statements, s)
+	case *ast.ForEachExpression:
+		c.checkExpression(x.Collection, s)
+		if x.Key != nil {
+			c.declare(x.Key, s, &binding{arity: unknownArity})
+		}
+		c.declare(x.Value, s, &binding{arity: unknownArity})
+		c.checkStatements(x.LoopBody.Statements, s)
+	case *ast.TryExpression:
+		c.checkStatements(x.TryBody.Statements, s)
+		c.declare(x.ErrName, s, &binding{arity: unknownArity})
+		c.checkStatements(x.CatchBody.Statements, s)
+	}
+	return ""
+}
+
+// checkCall : checks a call, and the number of arguments it passes when the
+// callee is known
+func (c *Checker) checkCall(call *ast.FunctionCallExpression, s *scope) {
+	c.checkExpression(call.Function, s)
+	for _, arg := range call.Arguments {
+		c.checkExpression(arg, s)
+	}
+
+	got := len(call.Arguments)
+	switch callee := call.Function.(type) {
+	case *ast.FunctionExpression:
+		c.checkArity(call, "function", len(callee.Params), false, got)
+	case *ast.Identifier:
+		if b, ok := s.lookup(callee.Value); ok {
+			if b.arity != unknownArity && !c.reassigned[callee.Value] {
+				c.checkArity(call, fmt.Sprintf("function %q", callee.Value), b.arity, false, got)
+			}
+		} else if bin, ok := c.ev.BuiltIn(callee.Value); ok && bin.Sig != nil {
+			params := len(bin.Sig.Params)
+			if bin.Sig.Variadic && params > 0 {
+				c.checkArity(call, callee.Value, params-1, true, got)
+			} else {
+				c.checkArity(call, callee.Value, params, false, got)
+			}
+		}
+	}
+}
+
+// valueOf : what is known of the value of an expression that a name is
+// declared with: the number of parameters of a function literal, or of the
+// function another name is bound to
+func (c *Checker) valueOf(x ast.Expression, s *scope) *binding {
+	switch x := x.(type) {
+	case *ast.FunctionExpression:
+		return &binding{arity: len(x.Params), function: x}
+	case *ast.Identifier:
+		if b, ok := s.lookup(x.Value); ok && !c.reassigned[x.Value] {
+			return &binding{arity: b.arity, function: b.function}
+		}
+	}
+	return &binding{arity: unknownArity}
+}
+
+func (c *Checker) checkArity(call *ast.FunctionCallExpression, callee string, want int, atLeast bool, got int) {
+	if atLeast && got < want {
+		c.report(ERROR, call.Function, "%s takes at least %d argument(s), got %d", callee, want, got)
+	} else if !atLeast && got != want {
+		c.report(ERROR, call.Function, "%s takes %d argument(s), got %d", callee, want, got)
+	}
+}
+
+// the values operators are tried on to find the type of their result. The
+// numbers are not zero, so that division by them succeeds.
+var samples = map[obj.ObjectType]obj.Object{
+	obj.INTEGER:  &obj.Integer{Value: 1},
+	obj.FLOATING: &obj.Floating{Value: 1},
+	obj.STRING:   &obj.String{Value: ""},
+	obj.BOOLEAN:  &obj.Boolean{Value: true},
+	obj.LIST:     &obj.List{Elements: []obj.Object{}},
+	obj.MAP:      obj.NewMap(),
+	obj.FUNCTION: &obj.Function{},
+}
+
+// checkPrefix : reports a prefix operator applied to a value of a type it
+// does not apply to, and returns the type of the result
+func (c *Checker) checkPrefix(x *ast.PrefixExpression, right obj.ObjectType) obj.ObjectType {
+	if right == "" {
+		return ""
+	}
+	result, ok := apply(func() obj.Object {
+		return evl.PrefixOperation(x.Operator, samples[right])
+	})
+	if !ok {
+		c.report(ERROR, x, "operator %q cannot be applied to a value of type %s", x.Operator, right)
+	}
+	return result
+}
+
+// checkInfix : reports an infix operator applied to values of types it does
+// not apply to, and returns the type of the result
+func (c *Checker) checkInfix(x *ast.InfixExpression, left, right obj.ObjectType) obj.ObjectType {
+	if left == "" || right == "" {
+		return ""
+	}
+	result, ok := apply(func() obj.Object {
+		return evl.InfixOperation(x.Operator, samples[left], samples[right])
+	})
+	if !ok {
+		c.report(ERROR, x, "operator %q cannot be applied to values of types %s and %s", x.Operator, left, right)
+	}
+	return result
+}
+
+// apply : runs an operation on sample values, returning the type of its
+// result, or false if it failed
+func apply(operation func() obj.Object) (result obj.ObjectType, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, ok = "", false
+		}
+	}()
+	value := operation()
+	if value == nil {
+		return "", false
+	}
+	return value.ObType(), true
+}
+
+// collectReassigned : records every name rebound with "name = ..." in a
+// program
+func collectReassigned(program *ast.Program, names map[string]bool) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		if assign, ok := node.(*ast.AssignStatement); ok {
+			if name, ok := assign.Target.(*ast.Identifier); ok {
+				names[name.Value] = true
+			}
+		}
+		return true
+	})
+}
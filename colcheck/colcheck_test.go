@@ -0,0 +1,82 @@
+package colcheck
+
+import (
+	evl "colon/coleval"
+	lex "colon/collex"
+	obj "colon/colobj"
+	par "colon/colparc"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// check : checks code with the builtins and the given globals declared, and
+// returns each diagnostic as "line:column severity: message"
+func check(t *testing.T, code string, globals *obj.Env) []string {
+	t.Helper()
+	lexer := lex.CreateLexerState(code)
+	parser := par.CreateParserState(lexer.Lex(), lexer.SourceLines())
+	program := parser.Parse()
+	if errs := parser.Errors(); len(errs) > 0 {
+		t.Fatalf("%q does not parse: %v", code, errs[0])
+	}
+	ev := evl.NewEvaluator(strings.NewReader(""), ioutil.Discard)
+	found := []string{}
+	for _, d := range NewChecker(ev, globals).Check(program) {
+		found = append(found, fmt.Sprintf("%d:%d %s: %s", d.Line, d.Column, d.Severity, d.Msg))
+	}
+	return found
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		code string
+		want []string
+	}{
+		{"v: a = 1\nprint(a + 2)\n", []string{}},
+		{"print(b)\n", []string{`1:7 Error: variable "b" is not declared before it is used`}},
+		{"b = 2\n", []string{`1:1 Error: variable "b" not declared. Use 'v: b = ...' to declare it`}},
+		{"v: g = f(x, y):\n    r: x + y\n:f\ng(1)\n", []string{"4:1 Error: function \"g\" takes 2 argument(s), got 1"}},
+		{"v: g = f():\n    r: 1\n    print(2)\n:f\n", []string{"3:5 Warning: unreachable code after r:"}},
+		{"v: a = 1\nv: g = f():\n    v: a = 2\n    r: a\n:f\n", []string{`3:8 Warning: "a" shadows the variable declared on line 1`}},
+		{"v: len = 1\n", []string{`1:4 Warning: "len" shadows the builtin of the same name`}},
+		{"print(1 - \"s\")\n", []string{`1:9 Error: operator "-" cannot be applied to values of types INTEGER and STRING`}},
+		// functions may use names declared after them, as they are checked last
+		{"v: g = f():\n    r: h()\n:f\nv: h = f():\n    r: 1\n:f\nprint(g())\n", []string{}},
+		// a name rebound with = may hold a function of any arity
+		{"v: g = f(x):\n    r: x\n:f\ng = f():\n    r: 1\n:f\ng()\n", []string{}},
+	}
+	for _, tc := range cases {
+		got := check(t, tc.code, nil)
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%q : got %q, want %q", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestCheckGlobals(t *testing.T) {
+	globals := obj.NewEnv()
+	globals.Set("host", &obj.Integer{Value: 1})
+	if got := check(t, "print(host)\n", globals); len(got) != 0 {
+		t.Errorf("a global is reported : %q", got)
+	}
+	want := `2:8 Warning: "host" shadows the global variable of the same name`
+	if got := check(t, "v: g = f():\n    v: host = 2\n    r: host\n:f\n", globals); len(got) != 1 || got[0] != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDiagnosticShowsSource(t *testing.T) {
+	lexer := lex.CreateLexerState("v: a = 1\nprint(a, b)\n")
+	program := par.CreateParserState(lexer.Lex(), lexer.SourceLines()).Parse()
+	ev := evl.NewEvaluator(strings.NewReader(""), ioutil.Discard)
+	diagnostics := NewChecker(ev, nil).Check(program)
+	if len(diagnostics) != 1 {
+		t.Fatalf("got %d diagnostics, want 1", len(diagnostics))
+	}
+	want := "Error on line 2, column 10 : variable \"b\" is not declared before it is used\n\n\tprint(a, b)\n\t         ^"
+	if got := diagnostics[0].Error(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
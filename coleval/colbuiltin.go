@@ -1,10 +1,10 @@
 package coleval
 
 import (
-	"bufio"
 	obj "colon/colobj"
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
 )
 
 var builtin = map[string]*obj.BuiltIn{
@@ -12,6 +12,7 @@ var builtin = map[string]*obj.BuiltIn{
 		/*
 			use: len(array)
 		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
 		Bfunct: func(args ...obj.Object) obj.Object {
 			if len(args) != 1 {
 				reportRuntimeError(fmt.Sprintf("len takes only 1 argument, got %v", len(args)))
@@ -25,6 +26,10 @@ var builtin = map[string]*obj.BuiltIn{
 				return &obj.Integer{
 					Value: int64(len(arg.Elements)),
 				}
+			case *obj.Map:
+				return &obj.Integer{
+					Value: int64(len(arg.Order)),
+				}
 			default:
 				reportRuntimeError(fmt.Sprintf("len cannot operate of type %q.", args[0].ObType()))
 			}
@@ -32,22 +37,8 @@ var builtin = map[string]*obj.BuiltIn{
 		},
 	},
 
-	"print": {
-		/*
-			use: print(stuff_to_print)
-		*/
-		Bfunct: func(args ...obj.Object) obj.Object {
-			if len(args) == 0 {
-				fmt.Println()
-			}
-			for _, v := range args {
-				fmt.Println(v.ObValue())
-			}
-			return EMPTY
-		},
-	},
-
 	"head": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
 		Bfunct: func(args ...obj.Object) obj.Object {
 			if len(args) != 1 {
 				reportRuntimeError(fmt.Sprintf("head takes only 1 argument, got %v", len(args)))
@@ -73,6 +64,7 @@ var builtin = map[string]*obj.BuiltIn{
 	},
 
 	"last": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
 		Bfunct: func(args ...obj.Object) obj.Object {
 			if len(args) != 1 {
 				reportRuntimeError(fmt.Sprintf("last takes only 1 argument, got %v", len(args)))
@@ -98,6 +90,7 @@ var builtin = map[string]*obj.BuiltIn{
 	},
 
 	"tail": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
 		Bfunct: func(args ...obj.Object) obj.Object {
 			if len(args) != 1 {
 				reportRuntimeError(fmt.Sprintf("tail takes only 1 argument, got %v", len(args)))
@@ -125,6 +118,7 @@ var builtin = map[string]*obj.BuiltIn{
 	},
 
 	"init": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
 		Bfunct: func(args ...obj.Object) obj.Object {
 			if len(args) != 1 {
 				reportRuntimeError(fmt.Sprintf("init takes only 1 argument, got %v", len(args)))
@@ -152,6 +146,7 @@ var builtin = map[string]*obj.BuiltIn{
 	},
 
 	"isNull": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
 		Bfunct: func(args ...obj.Object) obj.Object {
 			if len(args) != 1 {
 				reportRuntimeError(fmt.Sprintf("isNull takes only 1 argument, got %v", len(args)))
@@ -170,6 +165,7 @@ var builtin = map[string]*obj.BuiltIn{
 	},
 
 	"push": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{"", ""}, Variadic: true},
 		Bfunct: func(args ...obj.Object) obj.Object {
 			if len(args) == 1 {
 				reportRuntimeError("push takes a minimum of 3 arguments: a list and an element")
@@ -187,6 +183,8 @@ var builtin = map[string]*obj.BuiltIn{
 						arg.Elements = append(arg.Elements, args[k].(*obj.String))
 					} else if _, ok := args[k].(*obj.List); ok {
 						arg.Elements = append(arg.Elements, args[k].(*obj.List))
+					} else if _, ok := args[k].(*obj.Map); ok {
+						arg.Elements = append(arg.Elements, args[k].(*obj.Map))
 					} else {
 						reportRuntimeError(fmt.Sprintf("cannot push element of type %q into a list", args[k].ObType()))
 					}
@@ -199,34 +197,172 @@ var builtin = map[string]*obj.BuiltIn{
 			return nil
 		},
 	},
+
+	"keys": {
+		/*
+			use: keys(map) ---> list of the keys, in insertion order
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			m := mapArgument("keys", 1, args)
+			keys := &obj.List{Elements: []obj.Object{}}
+			for _, pair := range m.Entries() {
+				keys.Elements = append(keys.Elements, pair.Key)
+			}
+			return keys
+		},
+	},
+
+	"values": {
+		/*
+			use: values(map) ---> list of the values, in the order of their keys
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			m := mapArgument("values", 1, args)
+			values := &obj.List{Elements: []obj.Object{}}
+			for _, pair := range m.Entries() {
+				values.Elements = append(values.Elements, pair.Value)
+			}
+			return values
+		},
+	},
+
+	"has": {
+		/*
+			use: has(map, key)
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{"", ""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			m := mapArgument("has", 2, args)
+			_, ok := m.Get(hashKey(args[1]))
+			return makeBooleanObject(ok)
+		},
+	},
+
+	"del": {
+		/*
+			use: del(map, key) ---> removes key from the map, if present
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{"", ""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			m := mapArgument("del", 2, args)
+			m.Delete(hashKey(args[1]))
+			return EMPTY
+		},
+	},
+
+	"error": {
+		/*
+			use: error(message) ---> an error value, to be thrown with throw
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			if len(args) != 1 {
+				reportRuntimeError(fmt.Sprintf("error takes only 1 argument, got %v", len(args)))
+			}
+			return &obj.Error{Message: args[0].ObValue()}
+		},
+	},
+
+	"throw": {
+		/*
+			use: throw(error_or_message) ---> aborts with a runtime error, which a catch can handle
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			if len(args) != 1 {
+				reportRuntimeError(fmt.Sprintf("throw takes only 1 argument, got %v", len(args)))
+			}
+			if e, ok := args[0].(*obj.Error); ok {
+				throwError(e)
+			}
+			reportRuntimeError(args[0].ObValue())
+			return nil
+		},
+	},
+}
+
+// mapArgument : checks that a map builtin got n arguments, the first of
+// which is a map, and returns that map
+func mapArgument(name string, n int, args []obj.Object) *obj.Map {
+	if len(args) != n {
+		reportRuntimeError(fmt.Sprintf("%s takes %d argument(s), got %v", name, n, len(args)))
+	}
+	m, ok := args[0].(*obj.Map)
+	if !ok {
+		reportRuntimeError(fmt.Sprintf("%s cannot operate of type %q.", name, args[0].ObType()))
+	}
+	return m
 }
 
-var builtinTypeAssociations = map[string]obj.Object{
-	"int":  &obj.DataType{Dtype: "integer"},
-	"flt":  &obj.DataType{Dtype: "float"},
-	"bool": &obj.DataType{Dtype: "boolean"},
-	"str":  &obj.DataType{Dtype: "string"},
+// ioBuiltins : builtins that read from or write to the evaluator's input and output
+func (ev *Evaluator) ioBuiltins() map[string]*obj.BuiltIn {
+	return map[string]*obj.BuiltIn{
+		"print": {
+			/*
+				use: print(stuff_to_print)
+			*/
+			Bfunct: func(args ...obj.Object) obj.Object {
+				if len(args) == 0 {
+					fmt.Fprintln(ev.stdout)
+				}
+				for _, v := range args {
+					fmt.Fprintln(ev.stdout, v.ObValue())
+				}
+				return EMPTY
+			},
+		},
+
+		"readLine": {
+			/*
+				use: readLine() ---> the next line of input, without its line ending
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				return &obj.String{Value: ev.readLine("readLine")}
+			},
+		},
+
+		"readInt": {
+			/*
+				use: readInt() ---> the next line of input, which must hold an integer
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				line := strings.TrimSpace(ev.readLine("readInt"))
+				val, err := strconv.ParseInt(line, 10, 64)
+				if err != nil {
+					reportRuntimeError(fmt.Sprintf("readInt : %q is not an integer", line))
+				}
+				return &obj.Integer{Value: val}
+			},
+		},
+
+		"readFloat": {
+			/*
+				use: readFloat() ---> the next line of input, which must hold a number
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				line := strings.TrimSpace(ev.readLine("readFloat"))
+				val, err := strconv.ParseFloat(line, 64)
+				if err != nil {
+					reportRuntimeError(fmt.Sprintf("readFloat : %q is not a number", line))
+				}
+				return &obj.Floating{Value: val}
+			},
+		},
+	}
 }
 
-// GetInput : function that gets input and binds it to an name
-func GetInput(env *obj.Env, varname string, dtype obj.DataType) obj.Object {
-	switch dtype.Dtype {
-	case "integer":
-		var val int64
-		fmt.Scanf("%d\n", &val)
-		env.Set(varname, &obj.Integer{Value: int64(val)})
-	case "float":
-		var val float64
-		fmt.Scanf("%f\n", &val)
-		env.Set(varname, &obj.Floating{Value: float64(val)})
-	case "boolean":
-		var val bool
-		fmt.Scanf("%t\n", &val)
-		env.Set(varname, &obj.Boolean{Value: bool(val)})
-	case "string":
-		reader := bufio.NewReader(os.Stdin)
-		text, _ := reader.ReadString('\n')
-		env.Set(varname, &obj.String{Value: text})
+// readLine : reads the next line of the evaluator's input for the builtin
+// called name. Running out of input is a runtime error, but a last line
+// without a line ending is still read.
+func (ev *Evaluator) readLine(name string) string {
+	line, err := ev.stdin.ReadString('\n')
+	if err != nil && line == "" {
+		reportRuntimeError(fmt.Sprintf("%s : no more input to read", name))
 	}
-	return EMPTY
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
 }
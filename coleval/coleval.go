@@ -1,41 +1,240 @@
 package coleval
 
 import (
+	"bufio"
 	ast "colon/colast"
 	obj "colon/colobj"
+	par "colon/colparc"
+	tok "colon/coltok"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Storing values that are reused frequently
 var (
-	booleanTrue  = &obj.Boolean{Value: true}
-	booleanFalse = &obj.Boolean{Value: false}
+	booleanTrue  = obj.TrueObject
+	booleanFalse = obj.FalseObject
 	// EMPTY : the Null / Nil equivalent object in colon
-	EMPTY = &obj.Empty{}
+	EMPTY = obj.EmptyObject
+
+	breakSignal    = &obj.Break{}
+	continueSignal = &obj.Continue{}
 )
 
-// to know whether the evaluation happening at any moment is
-// inside a loop or not
-var inLoop bool = false
+// Scoping in colon is lexical, with one scope per function call: the body
+// of a function runs in a new env contained in the env the function was
+// defined in, while loops and if-else blocks run in the env they appear in.
+// "v: name = value" binds name in the current scope, shadowing any outer
+// binding, and "name = value" rebinds the nearest existing binding.
+
+// RuntimeError : an error raised while evaluating a program. Line and Column
+// are 1-based, and are 0 if the error could not be tied to a node. Source
+// holds the text of the offending line, and File the name of the file being
+// run, if any.
+type RuntimeError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+	Source string
+	Trace  []obj.Frame // the calls being evaluated when the error happened, innermost first
+}
+
+// the number of frames shown at each end of a long stack trace
+const traceEnds = 10
+
+func (e *RuntimeError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("Runtime Error: %s", e.Msg)
+	}
+	where := ""
+	if e.File != "" {
+		where = " in " + e.File
+	}
+	msg := fmt.Sprintf("Runtime Error%s on line %d, column %d : %s", where, e.Line, e.Column, e.Msg)
+	if e.Source != "" {
+		msg += "\n\n" + par.PointAt(e.Source, e.Column)
+	}
+	if len(e.Trace) > 0 {
+		msg += "\n\nStack trace (innermost call first) :"
+		for k, frame := range e.Trace {
+			if len(e.Trace) > 2*traceEnds && k == traceEnds {
+				msg += fmt.Sprintf("\n\t... %d more calls ...", len(e.Trace)-2*traceEnds)
+			}
+			if len(e.Trace) > 2*traceEnds && k >= traceEnds && k < len(e.Trace)-traceEnds {
+				continue
+			}
+			msg += "\n\t" + frame.String()
+		}
+	}
+	return msg
+}
+
+// Evaluator : the state shared by everything evaluated through it, such as
+// where the input and print builtins read from and write to
+type Evaluator struct {
+	stdin    *bufio.Reader
+	stdout   io.Writer
+	builtins map[string]*obj.BuiltIn
+	frames   []call                 // the colon functions being called, outermost first
+	importer Importer               // nil if modules cannot be imported
+	module   *obj.Module            // the module whose code is being evaluated, nil for the program being run
+	lines    []string               // the source of the code being evaluated, for error messages
+	std      map[string]*obj.Module // the standard modules imported so far
+	files    FileAccess             // which files the file builtins may reach
+}
+
+// Importer : loads the module that code in the module from, or in the
+// program being run if from is nil, imports by path. Failures are reported
+// with ReportError.
+type Importer func(path string, from *obj.Module) *obj.Module
 
-// Eval : evaluates the ast obtained after parsing
+// NewEvaluator : constructs an Evaluator that reads input from stdin and
+// prints to stdout. The read builtins share one buffered reader over stdin,
+// which is stdin itself if it is a *bufio.Reader, so that the caller can
+// go on reading from it without losing what the evaluator has buffered.
+func NewEvaluator(stdin io.Reader, stdout io.Writer) *Evaluator {
+	reader, ok := stdin.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(stdin)
+	}
+	ev := &Evaluator{
+		stdin:    reader,
+		stdout:   stdout,
+		builtins: map[string]*obj.BuiltIn{},
+	}
+	for name, bin := range builtin {
+		ev.RegisterBuiltIn(name, bin)
+	}
+	for name, bin := range stringBuiltins {
+		ev.RegisterBuiltIn(name, bin)
+	}
+	for name, bin := range listBuiltins {
+		ev.RegisterBuiltIn(name, bin)
+	}
+	for name, bin := range conversionBuiltins {
+		ev.RegisterBuiltIn(name, bin)
+	}
+	for name, bin := range ev.ioBuiltins() {
+		ev.RegisterBuiltIn(name, bin)
+	}
+	for name, bin := range ev.fileBuiltins() {
+		ev.RegisterBuiltIn(name, bin)
+	}
+	return ev
+}
+
+// Register : makes a Go function callable by name from code run through this
+// evaluator, replacing any builtin already registered under that name
+func (ev *Evaluator) Register(name string, fn obj.BuiltInFunction) {
+	ev.RegisterBuiltIn(name, &obj.BuiltIn{Bfunct: fn})
+}
+
+// RegisterBuiltIn : like Register, but takes a BuiltIn so that a Signature
+// can be given for the evaluator to check calls against
+func (ev *Evaluator) RegisterBuiltIn(name string, bin *obj.BuiltIn) {
+	registered := *bin
+	registered.Name = name
+	ev.builtins[name] = &registered
+}
+
+// SetImporter : sets how the modules imported by code run through this
+// evaluator are loaded
+func (ev *Evaluator) SetImporter(importer Importer) {
+	ev.importer = importer
+}
+
+// Import : the module imported by path from code in the module from. The
+// standard modules are imported by their name alone.
+func (ev *Evaluator) Import(path string, from *obj.Module) *obj.Module {
+	if module, ok := ev.stdModule(path); ok {
+		return module
+	}
+	if ev.importer == nil {
+		reportRuntimeError(fmt.Sprintf("cannot import %q : modules are not supported here", path))
+	}
+	return ev.importer(path, from)
+}
+
+// EvalModule : evaluates the top-level code of a module in the module's env.
+// Runtime errors unwind out of it as they do out of Eval.
+func (ev *Evaluator) EvalModule(program *ast.Program, module *obj.Module) obj.Object {
+	outer := ev.module
+	ev.module = module
+	defer func() { ev.module = outer }()
+	return ev.Eval(program, module.Env)
+}
+
+// BuiltIn : returns the builtin registered under a name
+func (ev *Evaluator) BuiltIn(name string) (*obj.BuiltIn, bool) {
+	bin, ok := ev.builtins[name]
+	return bin, ok
+}
+
+// BuiltinNames : returns the names of all builtins registered with the evaluator, sorted
+func (ev *Evaluator) BuiltinNames() []string {
+	names := []string{}
+	for name := range ev.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// the evaluator used by the package level Eval and Run, bound to the
+// process's stdin and stdout
+var stdEvaluator = NewEvaluator(os.Stdin, os.Stdout)
+
+// Eval : evaluates the ast obtained after parsing, reading from os.Stdin and
+// printing to os.Stdout. Runtime errors unwind out of Eval as a panic carrying
+// a *RuntimeError; use Run to get them as values.
 func Eval(node ast.Node, env *obj.Env) obj.Object {
+	return stdEvaluator.Eval(node, env)
+}
+
+// Run : like Eval, but returns runtime errors as values
+func Run(node ast.Node, env *obj.Env) (obj.Object, error) {
+	return stdEvaluator.Run(node, env)
+}
+
+// Run : evaluates the ast obtained after parsing, returning runtime errors
+// as values instead of letting them unwind into the caller
+func (ev *Evaluator) Run(node ast.Node, env *obj.Env) (result obj.Object, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, AsRuntimeError(r)
+		}
+	}()
+	return ev.Eval(node, env), nil
+}
+
+// Eval : evaluates the ast obtained after parsing. Runtime errors unwind
+// out of Eval as a panic carrying a *RuntimeError; use Run to get them as values.
+func (ev *Evaluator) Eval(node ast.Node, env *obj.Env) obj.Object {
+	defer ev.locateRuntimeError(node)
 	switch node := node.(type) {
 
 	case *ast.Program:
-		return evalProgram(node, env)
+		outer := ev.lines
+		ev.lines = node.Lines
+		defer func() { ev.lines = outer }()
+		return ev.evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return ev.Eval(node.Expression, env)
 
 	case *ast.PrefixExpression:
-		rightExpression := Eval(node.RightExpression, env)
+		rightExpression := ev.Eval(node.RightExpression, env)
 		return evalPrefixExpression(node.Operator, rightExpression, env)
 
 	case *ast.InfixExpression:
-		leftExpression := Eval(node.LeftExpression, env)
-		rightExpression := Eval(node.RightExpression, env)
+		leftExpression := ev.Eval(node.LeftExpression, env)
+		rightExpression := ev.Eval(node.RightExpression, env)
 		return evalInfixExpression(node.Operator, leftExpression, rightExpression, env)
 
 	case *ast.IntegerLiteral:
@@ -54,32 +253,32 @@ func Eval(node ast.Node, env *obj.Env) obj.Object {
 		return booleanFalse
 
 	case *ast.Block:
-		return evalBlock(node, env)
+		return ev.evalBlock(node, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return ev.evalIfExpression(node, env)
 
 	case *ast.ReturnStatement:
-		retVal := Eval(node.ReturnValue, env)
+		retVal := ev.Eval(node.ReturnValue, env)
 		return &obj.ReturnValue{Value: retVal}
 
+	case *ast.BreakStatement:
+		return breakSignal
+
+	case *ast.ContinueStatement:
+		return continueSignal
+
 	case *ast.VarStatement:
-		varVal := Eval(node.Value, env)
-		if varVal == EMPTY {
-			reportRuntimeError(fmt.Sprintf("expression assigned to variable %q did not evaluate to a value of a legal datatype", node.Name.Value))
-		}
-		if inLoop && env.IsInside() {
-			if _, inOuter := env.ContainedIn.Get(node.Name.Value); inOuter {
-				env.ContainedIn.Set(node.Name.Value, varVal)
-			} else {
-				env.Set(node.Name.Value, varVal)
-			}
-		} else {
-			env.Set(node.Name.Value, varVal)
-		}
+		Declare(env, node.Name.Value, ev.Eval(node.Value, env))
+
+	case *ast.ImportStatement:
+		Declare(env, node.Name.Value, ev.Import(node.Path, ev.module))
+
+	case *ast.AssignStatement:
+		ev.evalAssignStatement(node, env)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return ev.evalIdentifier(node, env)
 
 	case *ast.FunctionExpression:
 		params := node.Params
@@ -88,57 +287,58 @@ func Eval(node ast.Node, env *obj.Env) obj.Object {
 			Parameters: params,
 			FuncBody:   body,
 			Env:        env,
+			Module:     ev.module,
+			Lines:      ev.lines,
 		}
 
 	case *ast.FunctionCallExpression:
-		function := Eval(node.Function, env)
+		function := ev.Eval(node.Function, env)
 		if function == EMPTY {
 			reportRuntimeError(fmt.Sprintf("function %q not found.", node.Function.String()))
 		}
-		if function.ObType() == obj.INPUT {
-			var arguments []obj.Object
-			for _, v := range node.Arguments {
-				arguments = append(arguments, &obj.String{Value: v.String()})
-			}
-			return evalFunction(arguments, function, env)
+		arguments := ev.evalExpressions(node.Arguments, env)
+		if funct, ok := function.(*obj.Function); ok {
+			ev.pushFrame(callName(node.Function, funct), node.Function.Pos().Line+1, arguments)
+			defer ev.popFrame()
 		}
-
-		arguments := evalExpressions(node.Arguments, env)
-		return evalFunction(arguments, function, env)
+		return ev.evalFunction(arguments, function, callback{ev: ev, line: node.Function.Pos().Line + 1})
 
 		// i'm hoping that evalExpressions catches all the runtime errors
 
 	case *ast.LoopExpression:
-		return evalLoopExpression(node, env)
+		return ev.evalLoopExpression(node, env)
+
+	case *ast.ForEachExpression:
+		return ev.evalForEachExpression(node, env)
+
+	case *ast.TryExpression:
+		return ev.evalTryExpression(node, env)
 
 	case *ast.Array:
-		elements := evalExpressions(node.Elements, env)
+		elements := ev.evalExpressions(node.Elements, env)
 		return &obj.List{
 			Elements: elements,
 		}
 
+	case *ast.Map:
+		return ev.evalMapLiteral(node, env)
+
 	case *ast.ArrayIndexExpression:
-		leftExpression := Eval(node.LeftExpression, env)
-		index := Eval(node.Index, env)
-		if index, iok := index.(*obj.Integer); iok && index.Value >= 0 {
-			if list, ok := leftExpression.(*obj.List); ok {
-				if index.Value >= int64(len(list.Elements)) {
-					reportRuntimeError(fmt.Sprintf("cannot extract element a index '%v' from a list with '%v' elements", index.Value, len(list.Elements)))
-				}
-				return list.Elements[index.Value]
-			}
-			reportRuntimeError(fmt.Sprintf("cannot extract element from non-list expression"))
-		}
-		reportRuntimeError(fmt.Sprintf("index is not a non-negative integer"))
+		leftExpression := ev.Eval(node.LeftExpression, env)
+		index := ev.Eval(node.Index, env)
+		return evalIndexExpression(leftExpression, index)
+
+	case *ast.MemberExpression:
+		return MemberOperation(ev.Eval(node.LeftExpression, env), node.Member.Value)
 
 	}
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *obj.Env) obj.Object {
+func (ev *Evaluator) evalProgram(program *ast.Program, env *obj.Env) obj.Object {
 	var res obj.Object
 	for _, statement := range program.Statements {
-		res = Eval(statement, env)
+		res = ev.Eval(statement, env)
 		// PostEvalOutput = append(PostEvalOutput, res)
 		if retVal, ok := res.(*obj.ReturnValue); ok {
 			return retVal.Value
@@ -147,12 +347,12 @@ func evalProgram(program *ast.Program, env *obj.Env) obj.Object {
 	return res
 }
 
-func evalBlock(block *ast.Block, env *obj.Env) obj.Object {
+func (ev *Evaluator) evalBlock(block *ast.Block, env *obj.Env) obj.Object {
 	var res obj.Object
 	for _, statement := range block.Statements {
-		res = Eval(statement, env)
+		res = ev.Eval(statement, env)
 		// PostEvalOutput = append(PostEvalOutput, res)
-		if res != nil && res.ObType() == obj.RETVAL {
+		if res != nil && isSignal(res) {
 			return res
 		}
 	}
@@ -162,6 +362,21 @@ func evalBlock(block *ast.Block, env *obj.Env) obj.Object {
 	return res
 }
 
+// isSignal : whether an object interrupts the block it is produced in, to
+// be handled by the function or loop around the block
+func isSignal(res obj.Object) bool {
+	switch res.ObType() {
+	case obj.RETVAL, obj.BREAK, obj.CONTINUE:
+		return true
+	}
+	return false
+}
+
+// PrefixOperation : applies a prefix operator, "!" or "-", to a value
+func PrefixOperation(operator string, right obj.Object) obj.Object {
+	return evalPrefixExpression(operator, right, nil)
+}
+
 func evalPrefixExpression(operator string, rightExpression obj.Object, env *obj.Env) obj.Object {
 	switch operator {
 	case "!":
@@ -205,6 +420,11 @@ func evalNumericNegation(rightExpression obj.Object, env *obj.Env) obj.Object {
 	return nil
 }
 
+// InfixOperation : applies an infix operator to two values
+func InfixOperation(operator string, left obj.Object, right obj.Object) obj.Object {
+	return evalInfixExpression(operator, left, right, nil)
+}
+
 func evalInfixExpression(operator string, leftExpression obj.Object, rightExpression obj.Object, env *obj.Env) obj.Object {
 	leftExprType := leftExpression.ObType()
 	rightExprType := rightExpression.ObType()
@@ -247,21 +467,28 @@ func evalIntIntInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Ob
 			Value: lVal * rVal,
 		}
 	case "/":
+		if rVal == 0 {
+			reportRuntimeError("integer division by zero")
+		}
 		return &obj.Integer{
 			Value: lVal / rVal,
 		}
 	case "%":
+		if rVal == 0 {
+			reportRuntimeError("integer division by zero")
+		}
 		return &obj.Integer{
 			Value: lVal % rVal,
 		}
 	case "^":
-		var result int64 = 1
-		var i int64
-		for i = 0; i < rVal; i++ {
-			result = result * lVal
+		// a negative power of an integer is not in general an integer
+		if rVal < 0 {
+			return &obj.Floating{
+				Value: math.Pow(float64(lVal), float64(rVal)),
+			}
 		}
 		return &obj.Integer{
-			Value: result,
+			Value: intPow(lVal, rVal),
 		}
 	case ">":
 		return makeBooleanObject(lVal > rVal)
@@ -281,6 +508,20 @@ func evalIntIntInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Ob
 	return nil
 }
 
+// intPow : base to the power of a non-negative exponent, by repeated
+// squaring. Like the other integer operations it wraps around on overflow.
+func intPow(base int64, exponent int64) int64 {
+	var result int64 = 1
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exponent >>= 1
+	}
+	return result
+}
+
 func evalFltFltInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Object {
 	lVal := l.(*obj.Floating).Value
 	rVal := r.(*obj.Floating).Value
@@ -301,6 +542,14 @@ func evalFltFltInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Ob
 		return &obj.Floating{
 			Value: lVal / rVal,
 		}
+	case "%":
+		return &obj.Floating{
+			Value: math.Mod(lVal, rVal),
+		}
+	case "^":
+		return &obj.Floating{
+			Value: math.Pow(lVal, rVal),
+		}
 	case ">":
 		return makeBooleanObject(lVal > rVal)
 	case "<":
@@ -339,6 +588,14 @@ func evalIntFltInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Ob
 		return &obj.Floating{
 			Value: lVal / rVal,
 		}
+	case "%":
+		return &obj.Floating{
+			Value: math.Mod(lVal, rVal),
+		}
+	case "^":
+		return &obj.Floating{
+			Value: math.Pow(lVal, rVal),
+		}
 	case ">":
 		return makeBooleanObject(lVal > rVal)
 	case "<":
@@ -377,6 +634,14 @@ func evalFltIntInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Ob
 		return &obj.Floating{
 			Value: lVal / rVal,
 		}
+	case "%":
+		return &obj.Floating{
+			Value: math.Mod(lVal, rVal),
+		}
+	case "^":
+		return &obj.Floating{
+			Value: math.Pow(lVal, rVal),
+		}
 	case ">":
 		return makeBooleanObject(lVal > rVal)
 	case "<":
@@ -419,7 +684,8 @@ func evalLstLstInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Ob
 	rl := r.(*obj.List)
 	switch op {
 	case "+":
-		newList := append(ll.Elements, rl.Elements...)
+		newList := make([]obj.Object, 0, len(ll.Elements)+len(rl.Elements))
+		newList = append(append(newList, ll.Elements...), rl.Elements...)
 		return &obj.List{
 			Elements: newList,
 		}
@@ -445,31 +711,240 @@ func getStrValueFromObj(object obj.Object) string {
 	return object.(*obj.String).Value
 }
 
-func evalIfExpression(ife *ast.IfExpression, env *obj.Env) obj.Object {
-	condition := Eval(ife.Condition, env)
-	if condition.ObType() != obj.BOOLEAN {
-		reportRuntimeError(fmt.Sprintf("Condition does not evaluate to `true` or `false`"))
-	}
-	if getBolValueFromObj(condition) {
-		return Eval(ife.IfBody, env)
+func (ev *Evaluator) evalIfExpression(ife *ast.IfExpression, env *obj.Env) obj.Object {
+	if Condition(ev.Eval(ife.Condition, env)) {
+		return ev.Eval(ife.IfBody, env)
 	} else if ife.ElseBody != nil {
-		return Eval(ife.ElseBody, env)
+		return ev.Eval(ife.ElseBody, env)
 	} else {
 		return EMPTY
 	}
 }
 
+// ReportError : aborts the evaluation with a runtime error carrying msg.
+// Meant to be called by host functions registered as builtins.
+func ReportError(msg string) {
+	reportRuntimeError(msg)
+}
+
+// reportRuntimeError : aborts the evaluation with a runtime error. The error
+// is located at the innermost node being evaluated by locateRuntimeError.
 func reportRuntimeError(msg string) {
-	fmt.Printf("Runtime Error: %s\n", msg)
-	os.Exit(22)
+	panic(&RuntimeError{Msg: msg})
+}
+
+// locateRuntimeError : deferred by Eval so that a runtime error unwinding
+// through it gets the position of the innermost node it was raised in, and
+// the stack of calls leading to that node
+func (ev *Evaluator) locateRuntimeError(node ast.Node) {
+	if r := recover(); r != nil {
+		rerr := AsRuntimeError(r)
+		if rerr.Line == 0 && node != nil {
+			rerr.Locate(node.Pos(), ev.module, ev.lines)
+			rerr.Trace = ev.stackTrace()
+		}
+		panic(rerr)
+	}
+}
+
+// Locate : places a runtime error at a position in the source lines of a
+// module, or of the program being run if module is nil
+func (rerr *RuntimeError) Locate(pos tok.Position, module *obj.Module, lines []string) {
+	rerr.Line = pos.Line + 1
+	rerr.Column = pos.Column + 1
+	rerr.Source = par.SourceLine(lines, pos.Line)
+	if module != nil {
+		rerr.File = module.Path
+	}
+}
+
+// Value : converts a runtime error into the value bound by a catch
+func (rerr *RuntimeError) Value() *obj.Error {
+	return &obj.Error{
+		Message: rerr.Msg,
+		Line:    rerr.Line,
+		Column:  rerr.Column,
+		Source:  rerr.Source,
+		Trace:   rerr.Trace,
+	}
+}
+
+// throwError : aborts the evaluation with the error held by an error value.
+// An error that was thrown before keeps its position and trace; one made by
+// the error builtin gets those of the throw.
+func throwError(e *obj.Error) {
+	panic(&RuntimeError{
+		Line:   e.Line,
+		Column: e.Column,
+		Msg:    e.Message,
+		Source: e.Source,
+		Trace:  e.Trace,
+	})
+}
+
+// AsRuntimeError : converts a recovered value into a *RuntimeError, so that
+// failures inside builtins surface as errors rather than crashing the host
+func AsRuntimeError(r interface{}) *RuntimeError {
+	switch r := r.(type) {
+	case *RuntimeError:
+		return r
+	case error:
+		return &RuntimeError{Msg: r.Error()}
+	default:
+		return &RuntimeError{Msg: fmt.Sprint(r)}
+	}
+}
+
+func (ev *Evaluator) evalMapLiteral(node *ast.Map, env *obj.Env) obj.Object {
+	m := obj.NewMap()
+	for k, keyExpr := range node.Keys {
+		key := ev.Eval(keyExpr, env)
+		m.Set(hashKey(key), ev.Eval(node.Values[k], env))
+	}
+	return m
+}
+
+// HashKey : returns key as a Hashable, or reports an error if it cannot be used as a map key
+func HashKey(key obj.Object) obj.Hashable {
+	return hashKey(key)
+}
+
+// hashKey : returns key as a Hashable, or reports an error if it cannot be used as a map key
+func hashKey(key obj.Object) obj.Hashable {
+	hashable, ok := key.(obj.Hashable)
+	if !ok {
+		reportRuntimeError(fmt.Sprintf("value of type %q cannot be used as a map key", key.ObType()))
+	}
+	return hashable
+}
+
+// evalAssignStatement : rebinds an existing name, or stores a value into an
+// element of a list or map. The container is evaluated like any other
+// expression, so for nested targets such as grid[i][j] the innermost list is
+// the one that gets modified.
+func (ev *Evaluator) evalAssignStatement(node *ast.AssignStatement, env *obj.Env) {
+	if name, ok := node.Target.(*ast.Identifier); ok {
+		Reassign(env, name.Value, ev.Eval(node.Value, env))
+		return
+	}
+	target := node.Target.(*ast.ArrayIndexExpression)
+	container := ev.Eval(target.LeftExpression, env)
+	index := ev.Eval(target.Index, env)
+	AssignElement(container, index, ev.Eval(node.Value, env))
+}
+
+// Declare : binds name to value in the current scope, as "v: name = value" does
+func Declare(env *obj.Env, name string, value obj.Object) {
+	if value == nil || value.ObType() == obj.EMPTY {
+		reportRuntimeError(fmt.Sprintf("expression assigned to variable %q did not evaluate to a value of a legal datatype", name))
+	}
+	if funct, ok := value.(*obj.Function); ok && funct.Name == "" {
+		funct.Name = name
+	}
+	env.Set(name, value)
+}
+
+// Reassign : rebinds the nearest existing binding of name, as "name = value" does
+func Reassign(env *obj.Env, name string, value obj.Object) {
+	if value == nil || value.ObType() == obj.EMPTY {
+		reportRuntimeError(fmt.Sprintf("expression assigned to variable %q did not evaluate to a value of a legal datatype", name))
+	}
+	if !env.Assign(name, value) {
+		reportRuntimeError(fmt.Sprintf("variable %q not declared. Use 'v: %s = ...' to declare it", name, name))
+	}
+}
+
+// AssignElement : stores value into the element of a list or map at index
+func AssignElement(container obj.Object, index obj.Object, value obj.Object) {
+	if value == nil || value.ObType() == obj.EMPTY {
+		reportRuntimeError("expression assigned to element did not evaluate to a value of a legal datatype")
+	}
+	switch container := container.(type) {
+	case *obj.List:
+		i, ok := index.(*obj.Integer)
+		if !ok || i.Value < 0 {
+			reportRuntimeError(fmt.Sprintf("index is not a non-negative integer"))
+		}
+		if i.Value >= int64(len(container.Elements)) {
+			reportRuntimeError(fmt.Sprintf("cannot assign to element at index '%v' of a list with '%v' elements", i.Value, len(container.Elements)))
+		}
+		container.Elements[i.Value] = value
+	case *obj.Map:
+		container.Set(hashKey(index), value)
+	default:
+		reportRuntimeError(fmt.Sprintf("cannot assign to an element of a value of type %q", container.ObType()))
+	}
+}
+
+// IndexOperation : the element of a list, map or error at index
+func IndexOperation(left obj.Object, index obj.Object) obj.Object {
+	return evalIndexExpression(left, index)
+}
+
+func evalIndexExpression(left obj.Object, index obj.Object) obj.Object {
+	switch left := left.(type) {
+	case *obj.List:
+		i, ok := index.(*obj.Integer)
+		if !ok || i.Value < 0 {
+			reportRuntimeError(fmt.Sprintf("index is not a non-negative integer"))
+		}
+		if i.Value >= int64(len(left.Elements)) {
+			reportRuntimeError(fmt.Sprintf("cannot extract element a index '%v' from a list with '%v' elements", i.Value, len(left.Elements)))
+		}
+		return left.Elements[i.Value]
+	case *obj.Map:
+		if val, ok := left.Get(hashKey(index)); ok {
+			return val
+		}
+		reportRuntimeError(fmt.Sprintf("key %q not found in map", index.ObValue()))
+	case *obj.Error:
+		return errorField(left, index)
+	default:
+		reportRuntimeError(fmt.Sprintf("cannot extract element from non-list expression"))
+	}
+	return nil
+}
+
+// MemberOperation : the binding name of a module, read as module.name
+func MemberOperation(left obj.Object, name string) obj.Object {
+	module, ok := left.(*obj.Module)
+	if !ok {
+		reportRuntimeError(fmt.Sprintf("cannot read %q from a value of type %q. Only modules have members", name, left.ObType()))
+	}
+	member, ok := module.Member(name)
+	if !ok {
+		reportRuntimeError(fmt.Sprintf("module %q has no binding %q", module.Path, name))
+	}
+	return member
+}
+
+// errorField : the fields of an error value, read as err["message"],
+// err["line"], err["column"] and err["trace"]
+func errorField(e *obj.Error, field obj.Object) obj.Object {
+	switch field.ObValue() {
+	case "message":
+		return &obj.String{Value: e.Message}
+	case "line":
+		return &obj.Integer{Value: int64(e.Line)}
+	case "column":
+		return &obj.Integer{Value: int64(e.Column)}
+	case "trace":
+		trace := &obj.List{Elements: []obj.Object{}}
+		for _, frame := range e.Trace {
+			trace.Elements = append(trace.Elements, &obj.String{Value: frame.String()})
+		}
+		return trace
+	}
+	reportRuntimeError(fmt.Sprintf("errors have no field %q. Use \"message\", \"line\", \"column\" or \"trace\"", field.ObValue()))
+	return nil
 }
 
 func evalBolBolInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Object {
 	switch op {
 	case "==":
-		return makeBooleanObject(l == r)
+		return makeBooleanObject(getBolValueFromObj(l) == getBolValueFromObj(r))
 	case "!=":
-		return makeBooleanObject(l != r)
+		return makeBooleanObject(getBolValueFromObj(l) != getBolValueFromObj(r))
 	case "&":
 		return makeBooleanObject(getBolValueFromObj(l) && getBolValueFromObj(r))
 	case "|":
@@ -480,61 +955,193 @@ func evalBolBolInfix(op string, l obj.Object, r obj.Object, env *obj.Env) obj.Ob
 	return nil
 }
 
-func evalIdentifier(identifier *ast.Identifier, env *obj.Env) obj.Object {
-	if boundVal, ok := env.Get(identifier.Value); ok {
+func (ev *Evaluator) evalIdentifier(identifier *ast.Identifier, env *obj.Env) obj.Object {
+	return ev.Resolve(identifier.Value, env)
+}
+
+// Resolve : the value a name refers to in env: a binding, or else a builtin
+func (ev *Evaluator) Resolve(name string, env *obj.Env) obj.Object {
+	if boundVal, ok := env.Get(name); ok {
 		return boundVal
 	}
-	if bin, ok := builtin[identifier.Value]; ok {
+	if bin, ok := ev.builtins[name]; ok {
 		return bin
 	}
-	// if bin, ok := builtinTypeAssociations[identifier.Value]; ok {
-	// 	return bin
-	// }
-	if identifier.Value == "input" {
-		return &obj.InputFunction{
-			InFunc: GetInput,
-			ENV:    env,
-		}
-	}
-	reportRuntimeError(fmt.Sprintf("variable %q not initialized. Cannot use uninitialized variables in expressions", identifier.Value))
+	reportRuntimeError(fmt.Sprintf("variable %q not initialized. Cannot use uninitialized variables in expressions", name))
 	return nil
 }
 
-func evalExpressions(args []ast.Expression, env *obj.Env) []obj.Object {
+func (ev *Evaluator) evalExpressions(args []ast.Expression, env *obj.Env) []obj.Object {
 	evaluatedEArgs := []obj.Object{}
 	for _, v := range args {
-		ev := Eval(v, env)
+		evaluated := ev.Eval(v, env)
 		// Not sure if there are any potential errors that can occur here
-		if ev != nil {
-			evaluatedEArgs = append(evaluatedEArgs, ev)
+		if evaluated != nil {
+			evaluatedEArgs = append(evaluatedEArgs, evaluated)
 		}
 	}
 	return evaluatedEArgs
 }
 
-func evalFunction(arguments []obj.Object, function obj.Object, env *obj.Env) obj.Object {
+// Call : calls a function or builtin with arguments already evaluated. The
+// functions that a builtin like map calls are evaluated too.
+func (ev *Evaluator) Call(function obj.Object, arguments []obj.Object) obj.Object {
+	return ev.evalFunction(arguments, function, callback{ev: ev})
+}
+
+// CallWith : like Call, but the functions that a builtin like map calls are
+// run through caller, which is how the VM gets to run them itself
+func (ev *Evaluator) CallWith(function obj.Object, arguments []obj.Object, caller obj.Caller) obj.Object {
+	return ev.evalFunction(arguments, function, caller)
+}
+
+// callback : the Caller through which the evaluator runs the functions a
+// builtin calls. line is where the builtin was called, for stack traces.
+type callback struct {
+	ev   *Evaluator
+	line int
+}
+
+// CallFunction : calls function as if the builtin's call had called it
+func (cb callback) CallFunction(function obj.Object, args ...obj.Object) obj.Object {
+	if funct, ok := function.(*obj.Function); ok {
+		cb.ev.pushFrame(CallName("", funct), cb.line, args)
+		defer cb.ev.popFrame()
+	}
+	if result := cb.ev.evalFunction(args, function, cb); result != nil {
+		return result
+	}
+	return EMPTY
+}
+
+func (ev *Evaluator) evalFunction(arguments []obj.Object, function obj.Object, caller obj.Caller) obj.Object {
 	switch funct := function.(type) {
 	case *obj.Function:
+		if len(arguments) != len(funct.Parameters) {
+			reportRuntimeError(fmt.Sprintf("function takes %d argument(s), got %d", len(funct.Parameters), len(arguments)))
+		}
 		functEnv := createNewSubEnv(arguments, funct)
-		evaluatedFunct := Eval(funct.FuncBody, functEnv)
+		// the body is located in the source of the module it was defined in
+		outer, outerLines := ev.module, ev.lines
+		ev.module, ev.lines = funct.Module, funct.Lines
+		defer func() { ev.module, ev.lines = outer, outerLines }()
+		evaluatedFunct := ev.Eval(funct.FuncBody, functEnv)
 		return unwrapRetVal(evaluatedFunct)
 	case *obj.BuiltIn:
-		return funct.Bfunct(arguments...)
-	case *obj.InputFunction:
-		if len(arguments) == 2 {
-			if dtype, ok := builtinTypeAssociations[arguments[1].ObValue()].(*obj.DataType); ok {
-				return funct.InFunc(env, arguments[0].ObValue(), *dtype)
-			} else {
-				reportRuntimeError(fmt.Sprintf("datatype %q is not registered as a valid dataype in colon", dtype.Dtype))
-			}
+		if funct.Sig != nil {
+			checkSignature(funct, arguments)
+		}
+		if funct.Cfunct != nil {
+			return funct.Cfunct(caller, arguments...)
 		}
-		reportRuntimeError("the input function takes exactly 2 arguments")
+		return funct.Bfunct(arguments...)
 	default:
 		reportRuntimeError(fmt.Sprintf("expression %q is not/ doesn't have a valid funcion definition", function.ObValue()))
 	}
 	return nil
 }
 
+// callName : the name a function is called by in a trace: the name it is
+// bound to at the call, or else the name it was first bound to
+func callName(callee ast.Expression, funct *obj.Function) string {
+	switch callee := callee.(type) {
+	case *ast.Identifier:
+		return callee.Value
+	case *ast.MemberExpression:
+		return callee.String()
+	}
+	return CallName("", funct)
+}
+
+// CallName : the name a call to funct made through the name callee is shown
+// with in a trace. callee is "" when the function was not called by name.
+func CallName(callee string, funct *obj.Function) string {
+	if callee != "" {
+		return callee
+	}
+	if funct.Name != "" {
+		return funct.Name
+	}
+	return "<anonymous function>"
+}
+
+// the longest an argument is shown in a stack trace
+const maxArgLength = 24
+
+// call : a call to a colon function in progress. The arguments are only
+// described when a trace is needed.
+type call struct {
+	name string
+	line int
+	args []obj.Object
+}
+
+// DescribeCall : the frame shown in a trace for a call, made on a 1-based line
+func DescribeCall(name string, line int, arguments []obj.Object) obj.Frame {
+	args := []string{}
+	for _, arg := range arguments {
+		desc := arg.ObValue()
+		if arg.ObType() == obj.FUNCTION {
+			desc = "<function>"
+		} else if arg.ObType() == obj.STRING {
+			desc = strconv.Quote(desc)
+		}
+		if len(desc) > maxArgLength {
+			desc = desc[:maxArgLength-3] + "..."
+		}
+		args = append(args, desc)
+	}
+	return obj.Frame{Function: name, Line: line, Args: strings.Join(args, ", ")}
+}
+
+// MaxCallDepth : the largest number of nested calls to colon functions the
+// evaluator and the VM make before giving up with a runtime error, well
+// before the Go stack would overflow and take the host process with it
+const MaxCallDepth = 1 << 16
+
+// pushFrame : records the start of a call to a colon function
+func (ev *Evaluator) pushFrame(name string, line int, arguments []obj.Object) {
+	if len(ev.frames) >= MaxCallDepth {
+		reportRuntimeError(fmt.Sprintf("too many nested calls (more than %d)", MaxCallDepth))
+	}
+	ev.frames = append(ev.frames, call{name: name, line: line, args: arguments})
+}
+
+// popFrame : records the end of the innermost call
+func (ev *Evaluator) popFrame() {
+	ev.frames = ev.frames[:len(ev.frames)-1]
+}
+
+// stackTrace : the current calls, innermost first
+func (ev *Evaluator) stackTrace() []obj.Frame {
+	trace := make([]obj.Frame, len(ev.frames))
+	for k, c := range ev.frames {
+		trace[len(ev.frames)-1-k] = DescribeCall(c.name, c.line, c.args)
+	}
+	return trace
+}
+
+// checks the arguments of a call to a builtin against its signature
+func checkSignature(bin *obj.BuiltIn, arguments []obj.Object) {
+	params := bin.Sig.Params
+	if bin.Sig.Variadic && len(params) > 0 {
+		if len(arguments) < len(params)-1 {
+			reportRuntimeError(fmt.Sprintf("%s takes at least %d argument(s), got %d", bin.Name, len(params)-1, len(arguments)))
+		}
+	} else if len(arguments) != len(params) {
+		reportRuntimeError(fmt.Sprintf("%s takes %d argument(s), got %d", bin.Name, len(params), len(arguments)))
+	}
+	for k, arg := range arguments {
+		expected := params[len(params)-1]
+		if k < len(params) {
+			expected = params[k]
+		}
+		if expected != "" && arg.ObType() != expected {
+			reportRuntimeError(fmt.Sprintf("argument %d of %s must be of type %q, got %q", k+1, bin.Name, expected, arg.ObType()))
+		}
+	}
+}
+
 // creates a "scope" for the function being called.
 // this allows for creation of "local variables", i.e.,
 // variables that are local to the function
@@ -553,27 +1160,115 @@ func unwrapRetVal(EvalResult obj.Object) obj.Object {
 	return EvalResult
 }
 
-func evalLoopExpression(le *ast.LoopExpression, env *obj.Env) obj.Object {
-	var loopResult obj.Object
-	loopEnv := obj.NewInnerEnv(env)
-	condition := Eval(le.Condition, loopEnv)
-	if condition.ObType() != obj.BOOLEAN {
-		reportRuntimeError(fmt.Sprintf("Condition does not evaluate to `true` or `false`"))
+func (ev *Evaluator) evalLoopExpression(le *ast.LoopExpression, env *obj.Env) obj.Object {
+	var loopResult obj.Object = EMPTY
+	for ev.evalLoopCondition(le.Condition, env) {
+		result, done := ev.evalLoopBody(le.LoopBody, env)
+		if done {
+			return result
+		}
+		loopResult = result
+	}
+	return loopResult
+}
+
+// evalLoopBody : runs one iteration of a loop, handling the signals that
+// come out of the body. done is set when the loop has to end, in which case
+// result is what the loop evaluates to.
+func (ev *Evaluator) evalLoopBody(body *ast.Block, env *obj.Env) (result obj.Object, done bool) {
+	result = ev.Eval(body, env)
+	switch result.ObType() {
+	case obj.RETVAL:
+		// a return from inside the loop ends the loop and the function around it
+		return result, true
+	case obj.BREAK:
+		return EMPTY, true
+	case obj.CONTINUE:
+		return EMPTY, false
+	}
+	return result, false
+}
+
+// evalTryExpression : runs the try block, and if a runtime error aborts it,
+// runs the catch block with the error bound to its name in the current scope
+func (ev *Evaluator) evalTryExpression(te *ast.TryExpression, env *obj.Env) obj.Object {
+	result, rerr := ev.evalTryBlock(te.TryBody, env)
+	if rerr == nil {
+		return result
+	}
+	env.Set(te.ErrName.Value, rerr.Value())
+	return ev.Eval(te.CatchBody, env)
+}
+
+func (ev *Evaluator) evalTryBlock(body *ast.Block, env *obj.Env) (result obj.Object, rerr *RuntimeError) {
+	depth := len(ev.frames)
+	defer func() {
+		if r := recover(); r != nil {
+			result, rerr = nil, AsRuntimeError(r)
+			ev.frames = ev.frames[:depth]
+		}
+	}()
+	return ev.Eval(body, env), nil
+}
+
+// ForEachValues : the elements a for-each loop over collection runs for,
+// with their indexes or keys. A single loop variable over a map is bound
+// to the keys, so withKey false gives the keys as the values for a map.
+func ForEachValues(collection obj.Object, withKey bool) (keys, values []obj.Object) {
+	switch collection := collection.(type) {
+	case *obj.List:
+		values = append(values, collection.Elements...)
+		for k := range values {
+			keys = append(keys, &obj.Integer{Value: int64(k)})
+		}
+	case *obj.String:
+		for k := 0; k < len(collection.Value); k++ {
+			keys = append(keys, &obj.Integer{Value: int64(k)})
+			values = append(values, &obj.String{Value: string(collection.Value[k])})
+		}
+	case *obj.Map:
+		for _, pair := range collection.Entries() {
+			keys = append(keys, pair.Key)
+			values = append(values, pair.Value)
+		}
+		if !withKey {
+			values = keys
+		}
+	default:
+		reportRuntimeError(fmt.Sprintf("cannot loop over a value of type %q", collection.ObType()))
 	}
+	return keys, values
+}
 
-	// to signify that the evaluation is going inside a loop
-	inLoop = true
+// evalForEachExpression : runs the body once for each element of a list,
+// character of a string or key of a map, binding the loop variables in the
+// current scope. The elements are those present when the loop starts.
+func (ev *Evaluator) evalForEachExpression(fe *ast.ForEachExpression, env *obj.Env) obj.Object {
+	keys, values := ForEachValues(ev.Eval(fe.Collection, env), fe.Key != nil)
 
-	for getBolValueFromObj(condition) {
-		loopResult = Eval(le.LoopBody, loopEnv)
-		condition = Eval(le.Condition, loopEnv)
-		if condition.ObType() != obj.BOOLEAN {
-			reportRuntimeError(fmt.Sprintf("Condition does not evaluate to `true` or `false`"))
+	var loopResult obj.Object = EMPTY
+	for k := range values {
+		if fe.Key != nil {
+			env.Set(fe.Key.Value, keys[k])
+		}
+		env.Set(fe.Value.Value, values[k])
+		result, done := ev.evalLoopBody(fe.LoopBody, env)
+		if done {
+			return result
 		}
+		loopResult = result
 	}
+	return loopResult
+}
 
-	// to signify that the evaluation has come out of a loop
-	inLoop = false
+func (ev *Evaluator) evalLoopCondition(condition ast.Expression, env *obj.Env) bool {
+	return Condition(ev.Eval(condition, env))
+}
 
-	return unwrapRetVal(loopResult)
+// Condition : the value of the condition of an if or a loop, which must be a boolean
+func Condition(condition obj.Object) bool {
+	if condition.ObType() != obj.BOOLEAN {
+		reportRuntimeError(fmt.Sprintf("Condition does not evaluate to `true` or `false`"))
+	}
+	return getBolValueFromObj(condition)
 }
@@ -0,0 +1,236 @@
+package coleval
+
+import (
+	lex "colon/collex"
+	obj "colon/colobj"
+	par "colon/colparc"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// evalCase : a program, the input it reads, what it prints, and the message
+// of the runtime error it stops with, if any
+type evalCase struct {
+	code   string
+	input  string
+	output string
+	err    string
+}
+
+func run(code string) (string, error) {
+	return runWithInput(code, "")
+}
+
+func runWithInput(code, input string) (string, error) {
+	l := lex.CreateLexerState(code)
+	p := par.CreateParserState(l.Lex(), l.SourceLines())
+	program := p.Parse()
+	if errs := p.Errors(); len(errs) > 0 {
+		return "", errs[0]
+	}
+	var out strings.Builder
+	_, err := NewEvaluator(strings.NewReader(input), &out).Run(program, obj.NewEnv())
+	return out.String(), err
+}
+
+func runCases(t *testing.T, cases []evalCase) {
+	t.Helper()
+	for _, c := range cases {
+		output, err := runWithInput(c.code, c.input)
+		var re *RuntimeError
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%q : %v", c.code, err)
+		case c.err != "" && !errors.As(err, &re):
+			t.Errorf("%q : got %v, want runtime error %q", c.code, err, c.err)
+		case c.err != "" && !strings.Contains(re.Msg, c.err):
+			t.Errorf("%q : got runtime error %q, want %q", c.code, re.Msg, c.err)
+		}
+		if output != c.output {
+			t.Errorf("%q : printed %q, want %q", c.code, output, c.output)
+		}
+	}
+}
+
+func TestMaps(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "v: m = {\"a\" = 1, 2 = \"two\", true = 3.5}\nprint(m[\"a\"])\nprint(m[2])\nprint(m[true])\n", output: "1\ntwo\n3.5\n"},
+		{code: "v: m = {}\nprint(len(m))\n", output: "0\n"},
+		{code: "v: m = {\"b\" = 1, \"a\" = 2}\nprint(keys(m))\nprint(values(m))\n", output: "[b, a]\n[1, 2]\n"},
+		{code: "v: m = {\"a\" = 1}\nprint(has(m, \"a\"))\nprint(has(m, \"b\"))\ndel(m, \"a\")\nprint(len(m))\n", output: "true\nfalse\n0\n"},
+		{code: "v: m = {\"a\" = 1}\nprint(has(m, \"a\") == true)\n", output: "true\n"},
+		{code: "v: m = {\"a\" = 1}\nprint(m[\"b\"])\n", err: "b"},
+		{code: "v: m = {[1] = 1}\n", err: "LIST"},
+		{code: "keys([1])\n", err: "keys cannot operate"},
+		{code: "has({})\n", err: "has takes 2 argument(s), got 1"},
+	})
+}
+
+func TestElementAssignment(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "v: xs = [1, 2, 3]\nxs[0] = 10\nprint(xs)\n", output: "[10, 2, 3]\n"},
+		{code: "v: xs = [1, 2, 3]\nv: xs[2] = 30\nprint(xs)\n", output: "[1, 2, 30]\n"},
+		{code: "v: grid = [[1, 2], [3, 4]]\ngrid[1][0] = 0\nprint(grid)\n", output: "[[1, 2], [0, 4]]\n"},
+		{code: "v: m = {\"a\" = 1}\nm[\"a\"] = 2\nm[\"b\"] = 3\nprint(m)\n", output: "{a = 2, b = 3}\n"},
+		{code: "v: m = {\"xs\" = [1]}\nm[\"xs\"][0] = 5\nprint(m)\n", output: "{xs = [5]}\n"},
+		{code: "v: xs = [1]\nv: ys = xs\nys[0] = 2\nprint(xs)\n", output: "[2]\n"},
+		{code: "v: xs = [1]\nxs[1] = 2\n", err: "cannot assign to element at index '1' of a list with '1' elements"},
+		{code: "v: xs = [1]\nxs[0 - 1] = 2\n", err: "index is not a non-negative integer"},
+		{code: "v: xs = [1]\nxs[\"a\"] = 2\n", err: "index is not a non-negative integer"},
+		{code: "v: s = \"abc\"\ns[0] = \"x\"\n", err: "cannot assign to an element of a value of type \"STRING\""},
+		{code: "v: xs = [1]\nv: g = f():\n:f\nxs[0] = g()\n", err: "did not evaluate to a value"},
+	})
+}
+
+func TestSelfReferencingContainers(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "v: xs = [1, 2]\nxs[1] = xs\nprint(xs)\n", output: "[1, [...]]\n"},
+		{code: "v: m = {}\nm[\"self\"] = m\nprint(m)\n", output: "{self = {...}}\n"},
+		{code: "v: xs = [0]\nv: m = {\"xs\" = xs}\nxs[0] = m\nprint(xs)\nprint(m)\n", output: "[{xs = [...]}]\n{xs = [{...}]}\n"},
+		// a list held twice, but not inside itself, is printed in full
+		{code: "v: xs = [1]\nv: ys = [xs, xs]\nprint(ys)\n", output: "[[1], [1]]\n"},
+	})
+}
+
+func TestScoping(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "v: a = 1\na = 2\nprint(a)\n", output: "2\n"},
+		{code: "v: n = 0\nl(n < 3):\n    n = n + 1\n:l\nprint(n)\n", output: "3\n"},
+		// loops and if blocks share the enclosing scope
+		{code: "i(true):\n    v: a = 1\n:i\nprint(a)\n", output: "1\n"},
+		{code: "v: n = 0\nl(n < 1):\n    v: b = 5\n    n = n + 1\n:l\nprint(b)\n", output: "5\n"},
+		// v: in a function shadows, = rebinds the outer name
+		{code: "v: a = 1\nv: g = f():\n    v: a = 2\n:f\ng()\nprint(a)\n", output: "1\n"},
+		{code: "v: a = 1\nv: g = f():\n    a = 2\n:f\ng()\nprint(a)\n", output: "2\n"},
+		{code: "v: g = f():\n    v: local = 1\n:f\ng()\nprint(local)\n", err: "local"},
+		{code: "a = 1\n", err: "variable \"a\" not declared"},
+		// a return inside a loop ends the function
+		{code: "v: g = f():\n    v: n = 0\n    l(true):\n        n = n + 1\n        i(n == 3):\n            r: n\n        :i\n    :l\n:f\nprint(g())\n", output: "3\n"},
+		{code: "l(1):\n:l\n", err: "Condition does not evaluate to `true` or `false`"},
+	})
+}
+
+func TestBreakContinue(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "v: n = 0\nl(true):\n    n = n + 1\n    i(n == 3):\n        break\n    :i\n:l\nprint(n)\n", output: "3\n"},
+		{code: "v: n = 0\nl(n < 5):\n    n = n + 1\n    i(n % 2 == 0):\n        continue\n    :i\n    print(n)\n:l\n", output: "1\n3\n5\n"},
+		// break and continue apply to the innermost loop only
+		{code: "v: a = 0\nl(a < 2):\n    a = a + 1\n    v: b = 0\n    l(true):\n        b = b + 1\n        i(b == 2):\n            break\n        :i\n    :l\n    print(b)\n:l\n", output: "2\n2\n"},
+		// inside the else block of an if
+		{code: "v: n = 0\nl(true):\n    i(n < 2):\n        n = n + 1\n    :i e:\n        break\n    :e\n:l\nprint(n)\n", output: "2\n"},
+		// a loop in a function ended by break leaves the function running
+		{code: "v: g = f():\n    l(true):\n        break\n    :l\n    r: 7\n:f\nprint(g())\n", output: "7\n"},
+	})
+}
+
+func TestForEach(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "l(x in [1, 2, 3]):\n    print(x * 2)\n:l\n", output: "2\n4\n6\n"},
+		{code: "l(k, x in [\"a\", \"b\"]):\n    print(k)\n    print(x)\n:l\n", output: "0\na\n1\nb\n"},
+		{code: "l(c in \"abc\"):\n    print(c)\n:l\n", output: "a\nb\nc\n"},
+		{code: "v: m = {\"b\" = 1, \"a\" = 2}\nl(k in m):\n    print(k)\n:l\n", output: "b\na\n"},
+		{code: "v: m = {\"b\" = 1, \"a\" = 2}\nl(k, x in m):\n    print(x)\n:l\n", output: "1\n2\n"},
+		{code: "l(x in []):\n    print(x)\n:l\nprint(\"done\")\n", output: "done\n"},
+		// the names stay bound after the loop, like names declared in its body
+		{code: "l(x in [1, 2]):\n:l\nprint(x)\n", output: "2\n"},
+		{code: "l(x in [1, 2, 3, 4]):\n    i(x == 2):\n        continue\n    :i\n    i(x == 4):\n        break\n    :i\n    print(x)\n:l\n", output: "1\n3\n"},
+		{code: "v: g = f(xs):\n    l(x in xs):\n        i(x > 1):\n            r: x\n        :i\n    :l\n    r: 0\n:f\nprint(g([1, 5, 9]))\n", output: "5\n"},
+		{code: "l(x in 5):\n:l\n", err: "cannot loop over a value of type \"INTEGER\""},
+	})
+}
+
+func TestStackTrace(t *testing.T) {
+	code := "v: inner = f(x):\n    r: x + nope\n:f\nv: outer = f(s):\n    r: inner(len(s))\n:f\nouter(\"abc\")\n"
+	_, err := run(code)
+	var re *RuntimeError
+	if !errors.As(err, &re) {
+		t.Fatalf("got %v, want a runtime error", err)
+	}
+	want := []obj.Frame{
+		{Function: "inner", Line: 5, Args: "3"},
+		{Function: "outer", Line: 7, Args: `"abc"`},
+	}
+	if len(re.Trace) != len(want) {
+		t.Fatalf("got trace %v, want %v", re.Trace, want)
+	}
+	for k := range want {
+		if re.Trace[k] != want[k] {
+			t.Errorf("frame %d : got %v, want %v", k, re.Trace[k], want[k])
+		}
+	}
+	if !strings.Contains(re.Error(), "Stack trace (innermost call first) :\n\tinner(3) called on line 5\n\touter(\"abc\") called on line 7") {
+		t.Errorf("got %q", re.Error())
+	}
+}
+
+func TestLongStackTrace(t *testing.T) {
+	code := "v: down = f(n):\n    i(n == 0):\n        r: nope\n    :i\n    r: down(n - 1)\n:f\ndown(100)\n"
+	_, err := run(code)
+	var re *RuntimeError
+	if !errors.As(err, &re) {
+		t.Fatalf("got %v, want a runtime error", err)
+	}
+	if len(re.Trace) != 101 {
+		t.Errorf("got %d frames, want 101", len(re.Trace))
+	}
+	msg := re.Error()
+	if !strings.Contains(msg, "... 81 more calls ...") || strings.Count(msg, "called on line") != 2*traceEnds {
+		t.Errorf("got %q", msg)
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "v: g = f(n):\n    r: g(n + 1)\n:f\ng(0)\n", err: "too many nested calls"},
+	})
+}
+
+func TestTryCatch(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "t :\n    print(1)\n    print(nope)\n    print(2)\n:t c (err) :\n    print(err[\"line\"])\n:c\nprint(3)\n", output: "1\n3\n3\n"},
+		{code: "t :\n    print(1)\n:t c (err) :\n    print(2)\n:c\n", output: "1\n"},
+		{code: "t :\n    throw(\"boom\")\n:t c (err) :\n    print(err[\"message\"])\n:c\n", output: "boom\n"},
+		{code: "t :\n    throw(error(\"made\"))\n:t c (problem) :\n    print(problem[\"message\"])\n    print(problem[\"line\"])\n:c\n", output: "made\n2\n"},
+		// errors raised in calls are caught, with the calls in the trace
+		{code: "v: g = f():\n    r: 1 + nope\n:f\nt :\n    g()\n:t c (err) :\n    print(len(err[\"trace\"]))\n:c\n", output: "1\n"},
+		// a rethrown error keeps going to the next catch out
+		{code: "t :\n    t :\n        throw(\"inner\")\n    :t c (err) :\n        throw(err)\n    :c\n:t c (err) :\n    print(err[\"message\"])\n:c\n", output: "inner\n"},
+		{code: "t :\n    throw(\"uncaught\")\n:t c (err) :\n    throw(err)\n:c\n", err: "uncaught"},
+		// a catch inside a loop lets the loop go on
+		{code: "l(x in [1, 0, 2]):\n    t :\n        i(x == 0):\n            throw(\"zero\")\n        :i\n        print(x)\n    :t c (err) :\n        continue\n    :c\n:l\n", output: "1\n2\n"},
+		{code: "readInt()\n", input: "abc\n", err: "readInt : \"abc\" is not an integer"},
+		{code: "t :\n    readInt()\n:t c (err) :\n    print(err[\"message\"])\n:c\n", output: "readInt : no more input to read\n"},
+	})
+}
+
+func TestTryCatchNamesStillWork(t *testing.T) {
+	// t and c are keywords only where a try or its catch starts
+	runCases(t, []evalCase{
+		{code: "v: t = 1\nv: c = 2\nprint(t + c)\n", output: "3\n"},
+		{code: "v: g = f(t, c):\n    r: t * c\n:f\nprint(g(3, 4))\n", output: "12\n"},
+		{code: "v: c = [1]\nt :\n    c[0] = 5\n:t c (err) :\n:c\nprint(c)\n", output: "[5]\n"},
+	})
+}
+
+func TestReadBuiltins(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "print(readLine())\nprint(readLine())\n", input: "one\r\ntwo", output: "one\ntwo\n"},
+		{code: "print(len(readLine()))\n", input: "\n", output: "0\n"},
+		{code: "print(readInt() + 1)\nprint(readFloat())\n", input: " 41 \n 2.5\t\n", output: "42\n2.5\n"},
+		{code: "print(readInt())\nprint(readLine())\n", input: "-7\nrest\n", output: "-7\nrest\n"},
+
+		{code: "readLine()\n", input: "", err: "readLine : no more input to read"},
+		{code: "readLine()\nreadLine()\n", input: "last", err: "readLine : no more input to read"},
+		{code: "readInt()\n", input: "\n", err: `readInt : "" is not an integer`},
+		{code: "readInt()\n", input: "12abc\n", err: `readInt : "12abc" is not an integer`},
+		{code: "readInt()\n", input: "1.5\n", err: `readInt : "1.5" is not an integer`},
+		{code: "readInt()\n", input: "1 2\n", err: `readInt : "1 2" is not an integer`},
+		{code: "readInt()\n", input: "99999999999999999999\n", err: `readInt : "99999999999999999999" is not an integer`},
+		{code: "readInt()\n", input: "\x00\xff\n", err: `readInt : "\x00\xff" is not an integer`},
+		{code: "readFloat()\n", input: "two\n", err: `readFloat : "two" is not a number`},
+		{code: "readFloat()\n", input: "1e400\n", err: `readFloat : "1e400" is not a number`},
+		{code: "readFloat()\n", input: "", err: "readFloat : no more input to read"},
+		{code: "readInt(1)\n", err: "readInt"},
+	})
+}
@@ -0,0 +1,234 @@
+package coleval
+
+import (
+	obj "colon/colobj"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileAccess : which files the file builtins of an evaluator may reach. The
+// zero value lets them reach every file the process can.
+type FileAccess struct {
+	Disabled bool   // every call to a file builtin is a runtime error
+	Root     string // if set, only files under Root can be reached, and relative paths are taken from it
+}
+
+// SetFileAccess : sets which files the file builtins of code run through this
+// evaluator may reach
+func (ev *Evaluator) SetFileAccess(access FileAccess) {
+	if access.Root != "" {
+		if root, err := filepath.Abs(access.Root); err == nil {
+			access.Root = root
+		}
+	}
+	ev.files = access
+}
+
+// fileBuiltins : builtins that read and write files, through ev.filePath so
+// that they only reach the files ev.files allows
+func (ev *Evaluator) fileBuiltins() map[string]*obj.BuiltIn {
+	return map[string]*obj.BuiltIn{
+		"readFile": {
+			/*
+				use: readFile(path) ---> the contents of the file as a string
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				path := getStrValueFromObj(args[0])
+				data, err := ioutil.ReadFile(ev.filePath("readFile", path))
+				if err != nil {
+					fileError("readFile", "read", path, err)
+				}
+				return &obj.String{Value: string(data)}
+			},
+		},
+
+		"writeFile": {
+			/*
+				use: writeFile(path, str) ---> replaces the contents of the file, creating it if need be
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				path := getStrValueFromObj(args[0])
+				if err := ioutil.WriteFile(ev.filePath("writeFile", path), []byte(getStrValueFromObj(args[1])), 0644); err != nil {
+					fileError("writeFile", "write", path, err)
+				}
+				return EMPTY
+			},
+		},
+
+		"appendFile": {
+			/*
+				use: appendFile(path, str) ---> adds str to the end of the file, creating it if need be
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				path := getStrValueFromObj(args[0])
+				file, err := os.OpenFile(ev.filePath("appendFile", path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+				if err == nil {
+					_, err = file.WriteString(getStrValueFromObj(args[1]))
+					if cerr := file.Close(); err == nil {
+						err = cerr
+					}
+				}
+				if err != nil {
+					fileError("appendFile", "append to", path, err)
+				}
+				return EMPTY
+			},
+		},
+
+		"readLines": {
+			/*
+				use: readLines(path) ---> list of the lines of the file, without their line endings
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				path := getStrValueFromObj(args[0])
+				data, err := ioutil.ReadFile(ev.filePath("readLines", path))
+				if err != nil {
+					fileError("readLines", "read", path, err)
+				}
+				lines := &obj.List{Elements: []obj.Object{}}
+				text := strings.TrimSuffix(string(data), "\n")
+				if text == "" {
+					return lines
+				}
+				for _, line := range strings.Split(text, "\n") {
+					lines.Elements = append(lines.Elements, &obj.String{Value: strings.TrimSuffix(line, "\r")})
+				}
+				return lines
+			},
+		},
+
+		"exists": {
+			/*
+				use: exists(path) ---> whether there is a file or directory at path
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				_, err := os.Stat(ev.filePath("exists", getStrValueFromObj(args[0])))
+				return makeBooleanObject(err == nil)
+			},
+		},
+
+		"listDir": {
+			/*
+				use: listDir(path) ---> sorted list of the names of the entries of the directory
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				path := getStrValueFromObj(args[0])
+				infos, err := ioutil.ReadDir(ev.filePath("listDir", path))
+				if err != nil {
+					fileError("listDir", "list", path, err)
+				}
+				names := []string{}
+				for _, info := range infos {
+					names = append(names, info.Name())
+				}
+				sort.Strings(names)
+				entries := &obj.List{Elements: []obj.Object{}}
+				for _, name := range names {
+					entries.Elements = append(entries.Elements, &obj.String{Value: name})
+				}
+				return entries
+			},
+		},
+
+		"remove": {
+			/*
+				use: remove(path) ---> deletes the file, or the directory if it is empty
+			*/
+			Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				path := getStrValueFromObj(args[0])
+				if err := os.Remove(ev.filePath("remove", path)); err != nil {
+					fileError("remove", "remove", path, err)
+				}
+				return EMPTY
+			},
+		},
+	}
+}
+
+// The errors FilePath returns for files that cannot be reached
+var (
+	ErrFilesDisabled = errors.New("file access is disabled")
+	ErrOutsideRoot   = errors.New("outside the directory files may be reached in")
+)
+
+// filePath : the file a file builtin called name refers to by path, after
+// checking that ev.files lets it be reached
+func (ev *Evaluator) filePath(name string, path string) string {
+	file, err := ev.FilePath(path)
+	if err == ErrOutsideRoot {
+		reportRuntimeError(fmt.Sprintf("%s : %q is %s", name, path, err))
+	} else if err != nil {
+		reportRuntimeError(fmt.Sprintf("%s : %s", name, err))
+	}
+	return file
+}
+
+// FilePath : the file code run through this evaluator refers to by path, or
+// ErrFilesDisabled or ErrOutsideRoot if the evaluator's file access does not
+// let it be reached. It is for hosts that reach files on behalf of the code,
+// as imports do.
+func (ev *Evaluator) FilePath(path string) (string, error) {
+	if ev.files.Disabled {
+		return "", ErrFilesDisabled
+	}
+	root := ev.files.Root
+	if root == "" {
+		return path, nil
+	}
+	file := path
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(root, file)
+	}
+	file = filepath.Clean(file)
+	// a symbolic link under the root may still point out of it, so the
+	// check is made on the real paths as well
+	if !within(root, file) || !within(realPath(root), realPath(file)) {
+		return "", ErrOutsideRoot
+	}
+	return file, nil
+}
+
+// within : whether path is root or lies under it
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath : path with the symbolic links in the part of it that exists
+// resolved
+func realPath(path string) string {
+	rest := ""
+	for {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// fileError : reports that a file builtin could not do what it was asked to
+// the file at path. The path the script gave is shown rather than the one
+// it was resolved to, which may say where the root is.
+func fileError(name string, action string, path string, err error) {
+	if perr, ok := err.(*os.PathError); ok {
+		err = perr.Err
+	}
+	reportRuntimeError(fmt.Sprintf("%s cannot %s %q : %s", name, action, path, err))
+}
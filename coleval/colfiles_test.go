@@ -0,0 +1,128 @@
+package coleval
+
+import (
+	lex "colon/collex"
+	obj "colon/colobj"
+	par "colon/colparc"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runWithFiles : like run, with the file builtins kept to access
+func runWithFiles(code string, access FileAccess) (string, error) {
+	l := lex.CreateLexerState(code)
+	program := par.CreateParserState(l.Lex(), l.SourceLines()).Parse()
+	var out strings.Builder
+	ev := NewEvaluator(strings.NewReader(""), &out)
+	ev.SetFileAccess(access)
+	_, err := ev.Run(program, obj.NewEnv())
+	return out.String(), err
+}
+
+// fileTree : a temporary directory holding a root directory with a file in
+// it, a secret file next to the root, and links under the root to the
+// secret and to the directory it is in
+func fileTree(t *testing.T) (dir string, root string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "colfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "notes.txt"), []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("hunter2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Skip("symbolic links are not supported here:", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "up")); err != nil {
+		t.Fatal(err)
+	}
+	return dir, root
+}
+
+func TestFileBuiltins(t *testing.T) {
+	dir, root := fileTree(t)
+	defer os.RemoveAll(dir)
+	access := FileAccess{Root: root}
+
+	out, err := runWithFiles(strings.Join([]string{
+		`print(readLines("notes.txt"))`,
+		`writeFile("new.txt", "x")`,
+		`appendFile("new.txt", "y")`,
+		`print(readFile("new.txt"))`,
+		`print(exists("new.txt"))`,
+		`remove("new.txt")`,
+		`print(exists("new.txt"))`,
+		`print(listDir("."))`,
+		`print(readFile("sub/../notes.txt"))`,
+	}, "\n")+"\n", access)
+	want := "[a, b]\nxy\ntrue\nfalse\n[link.txt, notes.txt, up]\na\nb\n\n"
+	if err != nil || out != want {
+		t.Errorf("printed %q, %v, want %q", out, err, want)
+	}
+
+	escapes := []string{
+		`readFile("../secret.txt")`,
+		`readFile("sub/../../secret.txt")`,
+		`readFile("` + filepath.Join(dir, "secret.txt") + `")`,
+		`readFile("link.txt")`,
+		`readFile("up/secret.txt")`,
+		`writeFile("up/planted.txt", "x")`,
+		`appendFile("../planted.txt", "x")`,
+		`exists("up/secret.txt")`,
+		`listDir("..")`,
+		`remove("up/secret.txt")`,
+	}
+	for _, code := range escapes {
+		out, err := runWithFiles(code+"\n", access)
+		if err == nil || !strings.Contains(err.Error(), "is outside the directory files may be reached in") {
+			t.Errorf("%s : got %v, want an error for a file outside the root", code, err)
+		}
+		if err != nil && (strings.Contains(err.Error(), "hunter2") || strings.Contains(err.Error(), root)) {
+			t.Errorf("%s : the error shows the secret or the root : %q", code, err)
+		}
+		if out != "" {
+			t.Errorf("%s : printed %q", code, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secret.txt")); err != nil {
+		t.Errorf("the secret was removed : %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "planted.txt")); err == nil {
+		t.Errorf("a file was written outside the root")
+	}
+}
+
+func TestFileBuiltinsDisabled(t *testing.T) {
+	_, err := runWithFiles("readFile(\"notes.txt\")\n", FileAccess{Disabled: true})
+	if err == nil || !strings.Contains(err.Error(), "readFile : file access is disabled") {
+		t.Errorf("got %v, want file access to be disabled", err)
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	dir, root := fileTree(t)
+	defer os.RemoveAll(dir)
+	ev := NewEvaluator(strings.NewReader(""), ioutil.Discard)
+	ev.SetFileAccess(FileAccess{Root: root})
+	if file, err := ev.FilePath("notes.txt"); err != nil || file != filepath.Join(root, "notes.txt") {
+		t.Errorf("got %q, %v", file, err)
+	}
+	if _, err := ev.FilePath("up/secret.txt"); err != ErrOutsideRoot {
+		t.Errorf("got %v, want ErrOutsideRoot", err)
+	}
+	ev.SetFileAccess(FileAccess{Disabled: true})
+	if _, err := ev.FilePath("notes.txt"); err != ErrFilesDisabled {
+		t.Errorf("got %v, want ErrFilesDisabled", err)
+	}
+}
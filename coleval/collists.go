@@ -0,0 +1,319 @@
+package coleval
+
+import (
+	obj "colon/colobj"
+	"fmt"
+	"sort"
+)
+
+// maxRangeLength : the longest list range makes, so that a mistaken bound
+// fails with a runtime error instead of exhausting memory
+const maxRangeLength = 1 << 24
+
+// Builtins for working with lists. Those that take a function call it
+// through the obj.Caller they are given, so that it runs on whichever of the
+// evaluator and the VM called the builtin. None of them change the lists
+// they are given.
+var listBuiltins = map[string]*obj.BuiltIn{
+	"map": {
+		/*
+			use: map(list, f) ---> list of f(x) for every x in list
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, ""}},
+		Cfunct: func(caller obj.Caller, args ...obj.Object) obj.Object {
+			fn := functionArgument("map", args[1])
+			mapped := &obj.List{Elements: []obj.Object{}}
+			for _, element := range args[0].(*obj.List).Elements {
+				mapped.Elements = append(mapped.Elements, caller.CallFunction(fn, element))
+			}
+			return mapped
+		},
+	},
+
+	"filter": {
+		/*
+			use: filter(list, f) ---> list of the elements x of list for which f(x) is true
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, ""}},
+		Cfunct: func(caller obj.Caller, args ...obj.Object) obj.Object {
+			fn := functionArgument("filter", args[1])
+			kept := &obj.List{Elements: []obj.Object{}}
+			for _, element := range args[0].(*obj.List).Elements {
+				if predicate("filter", caller.CallFunction(fn, element)) {
+					kept.Elements = append(kept.Elements, element)
+				}
+			}
+			return kept
+		},
+	},
+
+	"reduce": {
+		/*
+			use: reduce(list, f, initial) ---> f(...f(f(initial, x1), x2)..., xn). Without
+			initial, the first element is used in its place.
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, "", ""}, Variadic: true},
+		Cfunct: func(caller obj.Caller, args ...obj.Object) obj.Object {
+			atMost("reduce", 3, args)
+			fn := functionArgument("reduce", args[1])
+			elements := args[0].(*obj.List).Elements
+			var acc obj.Object
+			if len(args) == 3 {
+				acc = args[2]
+			} else if len(elements) == 0 {
+				reportRuntimeError("reduce cannot reduce an empty list without an initial value")
+			} else {
+				acc, elements = elements[0], elements[1:]
+			}
+			for _, element := range elements {
+				acc = caller.CallFunction(fn, acc, element)
+			}
+			return acc
+		},
+	},
+
+	"sort": {
+		/*
+			use: sort(list) ---> the elements of list in increasing order, which must all be
+			numbers or all be strings.
+			sort(list, before) ---> the elements in the order where before(a, b) is true
+			when a comes before b.
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, ""}, Variadic: true},
+		Cfunct: func(caller obj.Caller, args ...obj.Object) obj.Object {
+			atMost("sort", 2, args)
+			sorted := &obj.List{Elements: append([]obj.Object{}, args[0].(*obj.List).Elements...)}
+			var less func(a, b obj.Object) bool
+			if len(args) == 2 {
+				fn := functionArgument("sort", args[1])
+				less = func(a, b obj.Object) bool {
+					return predicate("sort", caller.CallFunction(fn, a, b))
+				}
+			} else {
+				less = naturalOrder(sorted.Elements)
+			}
+			sort.SliceStable(sorted.Elements, func(i, j int) bool {
+				return less(sorted.Elements[i], sorted.Elements[j])
+			})
+			return sorted
+		},
+	},
+
+	"any": {
+		/*
+			use: any(list, f) ---> whether f(x) is true for some x in list.
+			any(list) ---> whether some element of list, a list of booleans, is true.
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, ""}, Variadic: true},
+		Cfunct: func(caller obj.Caller, args ...obj.Object) obj.Object {
+			return makeBooleanObject(quantify("any", caller, args, true))
+		},
+	},
+
+	"all": {
+		/*
+			use: all(list, f) ---> whether f(x) is true for every x in list.
+			all(list) ---> whether every element of list, a list of booleans, is true.
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, ""}, Variadic: true},
+		Cfunct: func(caller obj.Caller, args ...obj.Object) obj.Object {
+			return makeBooleanObject(!quantify("all", caller, args, false))
+		},
+	},
+
+	"zip": {
+		/*
+			use: zip(a, b) ---> list of the pairs [a[k], b[k]], as long as the shorter list
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, obj.LIST}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			a, b := args[0].(*obj.List).Elements, args[1].(*obj.List).Elements
+			pairs := &obj.List{Elements: []obj.Object{}}
+			for k := 0; k < len(a) && k < len(b); k++ {
+				pairs.Elements = append(pairs.Elements, &obj.List{Elements: []obj.Object{a[k], b[k]}})
+			}
+			return pairs
+		},
+	},
+
+	"range": {
+		/*
+			use: range(end) ---> [0, 1, ..., end - 1]
+			range(start, end) ---> [start, ..., end - 1]
+			range(start, end, step) ---> [start, start + step, ...] up to, but not including, end
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.INTEGER, obj.INTEGER}, Variadic: true},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			atMost("range", 3, args)
+			start, end, step := int64(0), getIntValueFromObj(args[0]), int64(1)
+			if len(args) > 1 {
+				start, end = end, getIntValueFromObj(args[1])
+			}
+			if len(args) > 2 {
+				step = getIntValueFromObj(args[2])
+			}
+			if step == 0 {
+				reportRuntimeError("range cannot count in steps of 0")
+			}
+			length := rangeLength(start, end, step)
+			if length > maxRangeLength {
+				reportRuntimeError(fmt.Sprintf("range cannot make a list of %d numbers (at most %d)", length, maxRangeLength))
+			}
+			numbers := &obj.List{Elements: make([]obj.Object, 0, length)}
+			for k, n := uint64(0), start; k < length; k, n = k+1, n+step {
+				numbers.Elements = append(numbers.Elements, &obj.Integer{Value: n})
+			}
+			return numbers
+		},
+	},
+
+	"reverse": {
+		/*
+			use: reverse(list) ---> the elements of list in the opposite order.
+			reverse(str) ---> the bytes of str in the opposite order.
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			switch arg := args[0].(type) {
+			case *obj.List:
+				reversed := &obj.List{Elements: make([]obj.Object, len(arg.Elements))}
+				for k, element := range arg.Elements {
+					reversed.Elements[len(arg.Elements)-1-k] = element
+				}
+				return reversed
+			case *obj.String:
+				reversed := make([]byte, len(arg.Value))
+				for k := range arg.Value {
+					reversed[len(arg.Value)-1-k] = arg.Value[k]
+				}
+				return &obj.String{Value: string(reversed)}
+			}
+			reportRuntimeError(fmt.Sprintf("reverse cannot operate of type %q.", args[0].ObType()))
+			return nil
+		},
+	},
+
+	"slice": {
+		/*
+			use: slice(list, start, end) ---> list of the elements from start up to, but not
+			including, end
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, obj.INTEGER, obj.INTEGER}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			elements := args[0].(*obj.List).Elements
+			start, end := getIntValueFromObj(args[1]), getIntValueFromObj(args[2])
+			if start < 0 || end > int64(len(elements)) || start > end {
+				reportRuntimeError(fmt.Sprintf("cannot take the slice from %d to %d of a list of length %d", start, end, len(elements)))
+			}
+			return &obj.List{Elements: append([]obj.Object{}, elements[start:end]...)}
+		},
+	},
+}
+
+// rangeLength : how many numbers there are from start up to, but not
+// including, end in steps of step, which is not 0. It is worked out on
+// unsigned integers, which hold the distance between any two int64s.
+func rangeLength(start int64, end int64, step int64) uint64 {
+	var distance, stride uint64
+	switch {
+	case step > 0 && start < end:
+		distance, stride = uint64(end)-uint64(start), uint64(step)
+	case step < 0 && start > end:
+		distance, stride = uint64(start)-uint64(end), -uint64(step)
+	default:
+		return 0
+	}
+	length := distance / stride
+	if distance%stride != 0 {
+		length++
+	}
+	return length
+}
+
+// functionArgument : checks that the argument of a builtin called name is
+// something it can call
+func functionArgument(name string, arg obj.Object) obj.Object {
+	switch arg.(type) {
+	case *obj.Function, *obj.BuiltIn:
+		return arg
+	}
+	reportRuntimeError(fmt.Sprintf("%s takes a function, got %q", name, arg.ObType()))
+	return nil
+}
+
+// predicate : the boolean a function called by the builtin called name
+// returned, which must not be anything else
+func predicate(name string, result obj.Object) bool {
+	b, ok := result.(*obj.Boolean)
+	if !ok {
+		reportRuntimeError(fmt.Sprintf("%s needs a function returning true or false, got %q", name, result.ObType()))
+	}
+	return b.Value
+}
+
+// atMost : checks that a variadic builtin called name got at most n arguments
+func atMost(name string, n int, args []obj.Object) {
+	if len(args) > n {
+		reportRuntimeError(fmt.Sprintf("%s takes at most %d argument(s), got %d", name, n, len(args)))
+	}
+}
+
+// quantify : whether some element of the list, or the result of calling
+// the function on it, is want. It stops at the first that is.
+func quantify(name string, caller obj.Caller, args []obj.Object, want bool) bool {
+	atMost(name, 2, args)
+	var fn obj.Object
+	if len(args) == 2 {
+		fn = functionArgument(name, args[1])
+	}
+	for _, element := range args[0].(*obj.List).Elements {
+		if fn != nil {
+			if predicate(name, caller.CallFunction(fn, element)) == want {
+				return true
+			}
+			continue
+		}
+		b, ok := element.(*obj.Boolean)
+		if !ok {
+			reportRuntimeError(fmt.Sprintf("%s takes a list of booleans when it is not given a function, got an element of type %q", name, element.ObType()))
+		}
+		if b.Value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// naturalOrder : the order sort puts elements in when it is not given a
+// function: numbers by value and strings alphabetically. Lists that mix the
+// two, or hold anything else, cannot be sorted without a function.
+func naturalOrder(elements []obj.Object) func(a, b obj.Object) bool {
+	numbers, texts := 0, 0
+	for _, element := range elements {
+		switch element.(type) {
+		case *obj.Integer, *obj.Floating:
+			numbers++
+		case *obj.String:
+			texts++
+		default:
+			reportRuntimeError(fmt.Sprintf("sort cannot order values of type %q without a function", element.ObType()))
+		}
+	}
+	if numbers > 0 && texts > 0 {
+		reportRuntimeError("sort cannot order numbers and strings together without a function")
+	}
+	if texts > 0 {
+		return func(a, b obj.Object) bool {
+			return getStrValueFromObj(a) < getStrValueFromObj(b)
+		}
+	}
+	return func(a, b obj.Object) bool {
+		// integers are compared as integers, which floats cannot all hold
+		if x, ok := a.(*obj.Integer); ok {
+			if y, ok := b.(*obj.Integer); ok {
+				return x.Value < y.Value
+			}
+		}
+		return numberArgument(a) < numberArgument(b)
+	}
+}
@@ -0,0 +1,57 @@
+package coleval
+
+import "testing"
+
+func TestListBuiltins(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "print(map([1, 2, 3], f(x):\n    r: x * x\n:f))\n", output: "[1, 4, 9]\n"},
+		{code: "print(filter(range(10), f(x):\n    r: x % 3 == 0\n:f))\n", output: "[0, 3, 6, 9]\n"},
+		{code: "v: add = f(a, b):\n    r: a + b\n:f\nprint(reduce([1, 2, 3], add))\nprint(reduce([], add, 10))\n", output: "6\n10\n"},
+		{code: "print(sort([3, 1.5, 2]))\nprint(sort([\"b\", \"a\"]))\n", output: "[1.5, 2, 3]\n[a, b]\n"},
+		{code: "print(sort([1, 3, 2], f(a, b):\n    r: a > b\n:f))\n", output: "[3, 2, 1]\n"},
+		{code: "print(any([false, true]))\nprint(all([1, 2], f(x):\n    r: x > 1\n:f))\n", output: "true\nfalse\n"},
+		{code: "print(zip([1, 2, 3], [\"a\", \"b\"]))\n", output: "[[1, a], [2, b]]\n"},
+		{code: "print(range(3))\nprint(range(2, 5))\nprint(range(5, 0, -2))\nprint(range(0, 3, -1))\n", output: "[0, 1, 2]\n[2, 3, 4]\n[5, 3, 1]\n[]\n"},
+		{code: "print(reverse([1, 2, 3]))\nprint(reverse(\"abc\"))\nprint(slice([1, 2, 3, 4], 1, 3))\n", output: "[3, 2, 1]\ncba\n[2, 3]\n"},
+		// builtins may be passed where functions are taken
+		{code: "print(map([[1], [1, 2]], len))\n", output: "[1, 2]\n"},
+		// the lists given are left as they are
+		{code: "v: xs = [2, 1]\nv: ys = sort(xs)\nprint(xs)\nprint(ys)\n", output: "[2, 1]\n[1, 2]\n"},
+
+		{code: "reduce([], f(a, b):\n    r: a\n:f)\n", err: "reduce cannot reduce an empty list without an initial value"},
+		{code: "map([1], 2)\n", err: `map takes a function, got "INTEGER"`},
+		{code: "filter([1], f(x):\n    r: x\n:f)\n", err: `filter needs a function returning true or false, got "INTEGER"`},
+		{code: "sort([1, \"a\"])\n", err: "sort cannot order numbers and strings together without a function"},
+		{code: "sort([[1]])\n", err: `sort cannot order values of type "LIST" without a function`},
+		{code: "range(0, 10, 0)\n", err: "range cannot count in steps of 0"},
+		{code: "range(1, 2, 3, 4)\n", err: "range takes at most 3 argument(s), got 4"},
+		{code: "slice([1, 2], 1, 3)\n", err: "cannot take the slice from 1 to 3 of a list of length 2"},
+		// a runtime error in the function unwinds through the builtin
+		{code: "map([1, 0], f(x):\n    r: 1 / x\n:f)\n", err: "integer division by zero"},
+	})
+}
+
+func TestRangeLength(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "print(len(range(16777216)))\n", output: "16777216\n"},
+		{code: "range(16777217)\n", err: "range cannot make a list of 16777217 numbers (at most 16777216)"},
+		{code: "range(0, 3000000000)\n", err: "range cannot make a list of 3000000000 numbers"},
+		{code: "range(-9223372036854775807 - 1, 9223372036854775807)\n", err: "range cannot make a list of 18446744073709551615 numbers"},
+		{code: "range(9223372036854775807, -9223372036854775807 - 1, -1)\n", err: "range cannot make a list of 18446744073709551615 numbers"},
+		// counting up to the largest integer stops without wrapping around
+		{code: "print(range(9223372036854775806, 9223372036854775807))\n", output: "[9223372036854775806]\n"},
+		{code: "print(range(9223372036854775800, 9223372036854775807, 4))\n", output: "[9223372036854775800, 9223372036854775804]\n"},
+	})
+}
+
+// TestListBuiltinsOnCycles : lists that hold themselves are shown as [...]
+// by the builtins that print them, and the others do not walk into them
+func TestListBuiltinsOnCycles(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "v: xs = [1, 2]\nxs[1] = xs\nprint(str(xs))\nprint(join(xs, \"; \"))\nprint(format(\"{}\", xs))\n",
+			output: "[1, [...]]\n1; [1, [...]]\n[1, [...]]\n"},
+		{code: "v: xs = [1, 2]\nxs[0] = xs\nprint(reverse(xs))\nprint(len(map(xs, str)))\nprint(slice(xs, 1, 2))\n",
+			output: "[2, [[...], 2]]\n2\n[2]\n"},
+		{code: "v: m = {}\nm[\"self\"] = m\nprint(str(m))\nprint(zip([m], [m]))\n", output: "{self = {...}}\n[[{self = {...}}, {self = {...}}]]\n"},
+	})
+}
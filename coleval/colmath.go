@@ -0,0 +1,228 @@
+package coleval
+
+import (
+	obj "colon/colobj"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// conversionBuiltins : builtins converting values between the basic types
+var conversionBuiltins = map[string]*obj.BuiltIn{
+	"int": {
+		/*
+			use: int(value) ---> value as an integer. Floats are truncated towards zero,
+			strings are parsed and booleans become 1 or 0.
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			switch arg := args[0].(type) {
+			case *obj.Integer:
+				return arg
+			case *obj.Floating:
+				if math.IsNaN(arg.Value) || arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+					reportRuntimeError(fmt.Sprintf("int cannot convert %v to an integer", arg.Value))
+				}
+				return &obj.Integer{Value: int64(arg.Value)}
+			case *obj.String:
+				val, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if err != nil {
+					reportRuntimeError(fmt.Sprintf("int cannot convert %q to an integer", arg.Value))
+				}
+				return &obj.Integer{Value: val}
+			case *obj.Boolean:
+				if arg.Value {
+					return &obj.Integer{Value: 1}
+				}
+				return &obj.Integer{Value: 0}
+			}
+			reportRuntimeError(fmt.Sprintf("int cannot convert a value of type %q", args[0].ObType()))
+			return nil
+		},
+	},
+
+	"flt": {
+		/*
+			use: flt(value) ---> value as a float
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			switch arg := args[0].(type) {
+			case *obj.Integer:
+				return &obj.Floating{Value: float64(arg.Value)}
+			case *obj.Floating:
+				return arg
+			case *obj.String:
+				val, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					reportRuntimeError(fmt.Sprintf("flt cannot convert %q to a float", arg.Value))
+				}
+				return &obj.Floating{Value: val}
+			case *obj.Boolean:
+				if arg.Value {
+					return &obj.Floating{Value: 1}
+				}
+				return &obj.Floating{Value: 0}
+			}
+			reportRuntimeError(fmt.Sprintf("flt cannot convert a value of type %q", args[0].ObType()))
+			return nil
+		},
+	},
+
+	"str": {
+		/*
+			use: str(value) ---> value as a string, as print shows it
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			if arg, ok := args[0].(*obj.String); ok {
+				return arg
+			}
+			return &obj.String{Value: args[0].ObValue()}
+		},
+	},
+
+	"bool": {
+		/*
+			use: bool(value) ---> value as a boolean. Numbers are true unless they are 0, and
+			strings must read true or false (or t, f, 1, 0 and the like).
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			switch arg := args[0].(type) {
+			case *obj.Integer:
+				return makeBooleanObject(arg.Value != 0)
+			case *obj.Floating:
+				return makeBooleanObject(arg.Value != 0)
+			case *obj.String:
+				val, err := strconv.ParseBool(strings.TrimSpace(arg.Value))
+				if err != nil {
+					reportRuntimeError(fmt.Sprintf("bool cannot convert %q to a boolean", arg.Value))
+				}
+				return makeBooleanObject(val)
+			case *obj.Boolean:
+				return arg
+			}
+			reportRuntimeError(fmt.Sprintf("bool cannot convert a value of type %q", args[0].ObType()))
+			return nil
+		},
+	},
+}
+
+// stdModules : the modules built into colon, imported by their name alone,
+// as import "math". Each call makes the bindings of a new instance.
+var stdModules = map[string]func() map[string]obj.Object{
+	"math": mathModule,
+}
+
+// stdModule : the instance of a standard module shared by everything
+// evaluated through ev
+func (ev *Evaluator) stdModule(name string) (*obj.Module, bool) {
+	if module, ok := ev.std[name]; ok {
+		return module, true
+	}
+	bindings, ok := stdModules[name]
+	if !ok {
+		return nil, false
+	}
+	module := &obj.Module{Path: name, Env: obj.NewEnv()}
+	for member, value := range bindings() {
+		if bin, ok := value.(*obj.BuiltIn); ok {
+			bin.Name = name + "." + member
+		}
+		module.Env.Set(member, value)
+	}
+	if ev.std == nil {
+		ev.std = map[string]*obj.Module{}
+	}
+	ev.std[name] = module
+	return module, true
+}
+
+// mathModule : the bindings of the math module. Its functions take integers
+// and floats alike and, but for abs, min and max, return floats. Names with
+// digits cannot be written in colon, so there is logBase(x, base) in place
+// of log2 and log10.
+func mathModule() map[string]obj.Object {
+	unary := func(fn func(float64) float64) *obj.BuiltIn {
+		return &obj.BuiltIn{
+			Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				return &obj.Floating{Value: fn(numberArgument(args[0]))}
+			},
+		}
+	}
+	binary := func(fn func(float64, float64) float64) *obj.BuiltIn {
+		return &obj.BuiltIn{
+			Sig: &obj.Signature{Params: []obj.ObjectType{"", ""}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				return &obj.Floating{Value: fn(numberArgument(args[0]), numberArgument(args[1]))}
+			},
+		}
+	}
+	// extreme : min or max, which return the least or greatest of their
+	// arguments as it was given
+	extreme := func(greater bool) *obj.BuiltIn {
+		return &obj.BuiltIn{
+			Sig: &obj.Signature{Params: []obj.ObjectType{"", ""}, Variadic: true},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				best, bestValue := args[0], numberArgument(args[0])
+				for _, arg := range args[1:] {
+					if value := numberArgument(arg); (greater && value > bestValue) || (!greater && value < bestValue) {
+						best, bestValue = arg, value
+					}
+				}
+				return best
+			},
+		}
+	}
+	return map[string]obj.Object{
+		"pi": &obj.Floating{Value: math.Pi},
+		"e":  &obj.Floating{Value: math.E},
+
+		"sqrt":  unary(math.Sqrt),
+		"pow":   binary(math.Pow),
+		"floor": unary(math.Floor),
+		"ceil":  unary(math.Ceil),
+		"round": unary(math.Round),
+		"abs": &obj.BuiltIn{
+			Sig: &obj.Signature{Params: []obj.ObjectType{""}},
+			Bfunct: func(args ...obj.Object) obj.Object {
+				if i, ok := args[0].(*obj.Integer); ok {
+					if i.Value < 0 {
+						return &obj.Integer{Value: -i.Value}
+					}
+					return i
+				}
+				return &obj.Floating{Value: math.Abs(numberArgument(args[0]))}
+			},
+		},
+		"min": extreme(false),
+		"max": extreme(true),
+
+		"sin":  unary(math.Sin),
+		"cos":  unary(math.Cos),
+		"tan":  unary(math.Tan),
+		"asin": unary(math.Asin),
+		"acos": unary(math.Acos),
+		"atan": unary(math.Atan),
+		"exp":  unary(math.Exp),
+		"log":  unary(math.Log),
+		"logBase": binary(func(x, base float64) float64 {
+			return math.Log(x) / math.Log(base)
+		}),
+	}
+}
+
+// numberArgument : the value of an integer or float argument of a math function
+func numberArgument(arg obj.Object) float64 {
+	switch arg := arg.(type) {
+	case *obj.Integer:
+		return float64(arg.Value)
+	case *obj.Floating:
+		return arg.Value
+	}
+	reportRuntimeError(fmt.Sprintf("math functions operate on integers and floats, got %q", arg.ObType()))
+	return 0
+}
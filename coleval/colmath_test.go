@@ -0,0 +1,40 @@
+package coleval
+
+import "testing"
+
+func TestConversionBuiltins(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "print(int(3.9))\nprint(int(-3.9))\nprint(int(\"42\"))\nprint(int(true))\n", output: "3\n-3\n42\n1\n"},
+		{code: "print(flt(3))\nprint(flt(\"2.5\"))\n", output: "3\n2.5\n"},
+		{code: "print(str(12) + \"!\")\nprint(str([1, 2]))\n", output: "12!\n[1, 2]\n"},
+		{code: "print(bool(0))\nprint(bool(2.5))\nprint(bool(\"true\"))\n", output: "false\ntrue\ntrue\n"},
+
+		{code: "int(\"ten\")\n", err: `int cannot convert "ten" to an integer`},
+		{code: "int(\"1.5\")\n", err: `int cannot convert "1.5" to an integer`},
+		{code: "int([1])\n", err: `int cannot convert a value of type "LIST"`},
+		{code: "flt(\"x\")\n", err: `flt cannot convert "x" to a float`},
+		{code: "bool(\"yes\")\n", err: `bool cannot convert "yes" to a boolean`},
+	})
+}
+
+func TestMathModule(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "import \"math\"\nprint(math.sqrt(16))\nprint(math.pow(2, 10))\n", output: "4\n1024\n"},
+		{code: "import \"math\"\nprint(math.floor(2.5))\nprint(math.ceil(2.5))\nprint(math.round(2.5))\n", output: "2\n3\n3\n"},
+		{code: "import \"math\"\nprint(math.abs(-3))\nprint(math.abs(-2.5))\n", output: "3\n2.5\n"},
+		{code: "import \"math\"\nprint(math.min(3, 1, 2))\nprint(math.max(1, 2.5))\n", output: "1\n2.5\n"},
+		{code: "import \"math\"\nprint(math.logBase(8, 2))\nprint(math.exp(0))\nprint(math.sin(0))\n", output: "3\n1\n0\n"},
+		{code: "import \"math\" as m\nprint(m.pi > 3.14 & m.pi < 3.15)\nprint(m.e > 2.71 & m.e < 2.72)\n", output: "true\ntrue\n"},
+		{code: "import \"math\"\nimport \"math\" as again\nprint(again.floor(1.5))\n", output: "1\n"},
+
+		{code: "import \"math\"\nmath.sqrt(\"x\")\n", err: `math functions operate on integers and floats, got "STRING"`},
+	})
+}
+
+func TestPowerAndRemainder(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "print(2 ^ 10)\nprint(2 ^ -1)\nprint(3 ^ 0)\n", output: "1024\n0.5\n1\n"},
+		{code: "print(2.0 ^ 3)\nprint(4 ^ 0.5)\n", output: "8\n2\n"},
+		{code: "print(7.5 % 2)\nprint(7 % 2.5)\nprint(-7 % 3)\n", output: "1.5\n2\n-1\n"},
+	})
+}
@@ -0,0 +1,192 @@
+package coleval
+
+import (
+	obj "colon/colobj"
+	"fmt"
+	"strings"
+)
+
+// maxRepeatLength : the longest string repeat makes, in bytes. Longer
+// results are a runtime error rather than an allocation that can exhaust
+// memory.
+const maxRepeatLength = 1 << 24
+
+// Builtins for working with strings. Positions in strings are byte offsets,
+// as they are for len, and their signatures make the evaluator check the
+// types of their arguments before they are called.
+var stringBuiltins = map[string]*obj.BuiltIn{
+	"split": {
+		/*
+			use: split(str, separator) ---> list of the parts of str between separators,
+			or of its characters if the separator is ""
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			parts := &obj.List{Elements: []obj.Object{}}
+			for _, part := range strings.Split(getStrValueFromObj(args[0]), getStrValueFromObj(args[1])) {
+				parts.Elements = append(parts.Elements, &obj.String{Value: part})
+			}
+			return parts
+		},
+	},
+
+	"join": {
+		/*
+			use: join(list, separator) ---> the elements of list, printed and separated by separator
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.LIST, obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			parts := []string{}
+			for _, element := range args[0].(*obj.List).Elements {
+				parts = append(parts, element.ObValue())
+			}
+			return &obj.String{Value: strings.Join(parts, getStrValueFromObj(args[1]))}
+		},
+	},
+
+	"trim": {
+		/*
+			use: trim(str) ---> str without the white space at either end
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return &obj.String{Value: strings.TrimSpace(getStrValueFromObj(args[0]))}
+		},
+	},
+
+	"replace": {
+		/*
+			use: replace(str, old, new) ---> str with every old replaced by new
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING, obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return &obj.String{Value: strings.Replace(getStrValueFromObj(args[0]), getStrValueFromObj(args[1]), getStrValueFromObj(args[2]), -1)}
+		},
+	},
+
+	"contains": {
+		/*
+			use: contains(str, sub)
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return makeBooleanObject(strings.Contains(getStrValueFromObj(args[0]), getStrValueFromObj(args[1])))
+		},
+	},
+
+	"index": {
+		/*
+			use: index(str, sub) ---> position of the first sub in str, or -1
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return &obj.Integer{Value: int64(strings.Index(getStrValueFromObj(args[0]), getStrValueFromObj(args[1])))}
+		},
+	},
+
+	"upper": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return &obj.String{Value: strings.ToUpper(getStrValueFromObj(args[0]))}
+		},
+	},
+
+	"lower": {
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return &obj.String{Value: strings.ToLower(getStrValueFromObj(args[0]))}
+		},
+	},
+
+	"startsWith": {
+		/*
+			use: startsWith(str, prefix)
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return makeBooleanObject(strings.HasPrefix(getStrValueFromObj(args[0]), getStrValueFromObj(args[1])))
+		},
+	},
+
+	"endsWith": {
+		/*
+			use: endsWith(str, suffix)
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.STRING}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return makeBooleanObject(strings.HasSuffix(getStrValueFromObj(args[0]), getStrValueFromObj(args[1])))
+		},
+	},
+
+	"repeat": {
+		/*
+			use: repeat(str, n) ---> str n times over
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.INTEGER}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			str, n := getStrValueFromObj(args[0]), getIntValueFromObj(args[1])
+			if n < 0 {
+				reportRuntimeError(fmt.Sprintf("repeat cannot repeat a string %d times", n))
+			}
+			if len(str) > 0 && n > maxRepeatLength/int64(len(str)) {
+				reportRuntimeError(fmt.Sprintf("repeat cannot make a string longer than %d bytes", maxRepeatLength))
+			}
+			return &obj.String{Value: strings.Repeat(str, int(n))}
+		},
+	},
+
+	"substring": {
+		/*
+			use: substring(str, start, end) ---> the part of str from start up to, but not including, end
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.INTEGER, obj.INTEGER}},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			str := getStrValueFromObj(args[0])
+			start, end := getIntValueFromObj(args[1]), getIntValueFromObj(args[2])
+			if start < 0 || end > int64(len(str)) || start > end {
+				reportRuntimeError(fmt.Sprintf("cannot take the substring from %d to %d of a string of length %d", start, end, len(str)))
+			}
+			return &obj.String{Value: str[start:end]}
+		},
+	},
+
+	"format": {
+		/*
+			use: format("x = {}, y = {}", x, y) ---> the string with each {} replaced by the
+			next argument, printed. {{ and }} stand for { and }.
+		*/
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING, ""}, Variadic: true},
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return &obj.String{Value: format(getStrValueFromObj(args[0]), args[1:])}
+		},
+	},
+}
+
+// format : fills the {} placeholders of a template with the printed values
+// of args, in order
+func format(template string, args []obj.Object) string {
+	var out strings.Builder
+	used := 0
+	for k := 0; k < len(template); k++ {
+		switch {
+		case strings.HasPrefix(template[k:], "{{"):
+			out.WriteByte('{')
+			k++
+		case strings.HasPrefix(template[k:], "}}"):
+			out.WriteByte('}')
+			k++
+		case strings.HasPrefix(template[k:], "{}"):
+			if used < len(args) {
+				out.WriteString(args[used].ObValue())
+			}
+			used++
+			k++
+		default:
+			out.WriteByte(template[k])
+		}
+	}
+	if used != len(args) {
+		reportRuntimeError(fmt.Sprintf("format has %d placeholder(s) but got %d argument(s) to fill them", used, len(args)))
+	}
+	return out.String()
+}
@@ -0,0 +1,28 @@
+package coleval
+
+import "testing"
+
+func TestStringBuiltins(t *testing.T) {
+	runCases(t, []evalCase{
+		{code: "print(split(\"a,b,,c\", \",\"))\nprint(split(\"héllo\", \"\"))\n", output: "[a, b, , c]\n[h, é, l, l, o]\n"},
+		{code: "print(join([\"a\", 1, true], \", \"))\nprint(join([], \"-\"))\n", output: "a, 1, true\n\n"},
+		{code: "print(trim(\"  a b  \"))\nprint(replace(\"aXbX\", \"X\", \"--\"))\n", output: "a b\na--b--\n"},
+		{code: "print(contains(\"abc\", \"bc\"))\nprint(index(\"abcabc\", \"c\"))\nprint(index(\"abc\", \"z\"))\n", output: "true\n2\n-1\n"},
+		{code: "print(upper(\"aB\"))\nprint(lower(\"aB\"))\n", output: "AB\nab\n"},
+		{code: "print(startsWith(\"abc\", \"ab\"))\nprint(endsWith(\"abc\", \"ab\"))\n", output: "true\nfalse\n"},
+		{code: "print(repeat(\"ab\", 3))\nprint(len(repeat(\"\", 1000000000)))\n", output: "ababab\n0\n"},
+		{code: "print(substring(\"hello\", 1, 3))\nprint(substring(\"hello\", 5, 5))\n", output: "el\n\n"},
+		{code: "print(format(\"{} + {} = {}\", 1, 2, 3))\nprint(format(\"{{}} {}\", [1]))\n", output: "1 + 2 = 3\n{} [1]\n"},
+
+		{code: "repeat(\"ab\", -1)\n", err: "repeat cannot repeat a string -1 times"},
+		{code: "repeat(\"ab\", 8388609)\n", err: "repeat cannot make a string longer than 16777216 bytes"},
+		{code: "repeat(\"x\", 9223372036854775807)\n", err: "repeat cannot make a string longer than 16777216 bytes"},
+		{code: "substring(\"abc\", 2, 1)\n", err: "cannot take the substring from 2 to 1 of a string of length 3"},
+		{code: "substring(\"abc\", 0, 4)\n", err: "cannot take the substring from 0 to 4"},
+		{code: "format(\"{} {}\", 1)\n", err: "format has 2 placeholder(s) but got 1 argument(s) to fill them"},
+		{code: "split(1, \",\")\n", err: "split"},
+	})
+	if out, err := run("print(len(repeat(\"ab\", 8388608)))\n"); err != nil || out != "16777216\n" {
+		t.Errorf("a string of the largest length : printed %q, %v", out, err)
+	}
+}
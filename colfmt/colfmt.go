@@ -0,0 +1,338 @@
+package colfmt
+
+import (
+	"bytes"
+	ast "colon/colast"
+	lex "colon/collex"
+	"strings"
+)
+
+// indentation of each level of blocks
+const indentation = "    "
+
+// Format : the canonical source of a program. Blocks are indented by four
+// spaces, binary operators are surrounded by single spaces, there is one
+// statement per line and runs of blank lines are reduced to one. comments
+// and lines are the comments and the source lines the program was parsed
+// from; comments are kept on the line they were on, or before the statement
+// they came before.
+func Format(program *ast.Program, comments []lex.Comment, lines []string) string {
+	p := &printer{comments: comments, lines: lines, limit: len(lines)}
+	p.statements(program.Statements)
+	p.flushComments(len(lines), -1)
+	return strings.TrimLeft(p.out.String(), "\n") + "\n"
+}
+
+type printer struct {
+	out      bytes.Buffer
+	depth    int           // number of blocks around the current line
+	comments []lex.Comment // comments not yet printed
+	lines    []string
+	limit    int // line of the statement after the one being printed
+	column   int // column of the statement being printed
+	line     int // source line of what was printed last, as far as is known
+}
+
+func (p *printer) write(s ...string) {
+	for _, str := range s {
+		p.out.WriteString(str)
+	}
+}
+
+func (p *printer) newLine() {
+	p.out.WriteString("\n")
+	p.out.WriteString(strings.Repeat(indentation, p.depth))
+}
+
+// blankBefore : whether the source line before line is blank
+func (p *printer) blankBefore(line int) bool {
+	return line > 0 && line <= len(p.lines) && strings.TrimSpace(p.lines[line-1]) == ""
+}
+
+// statements : prints statements, each on a line of its own, with the
+// comments before them
+func (p *printer) statements(statements []ast.Statement) {
+	limit, column := p.limit, p.column
+	first := true
+	for k, stmt := range statements {
+		p.limit = limit
+		if k+1 < len(statements) {
+			p.limit = statements[k+1].Pos().Line
+		}
+		pos := stmt.Pos()
+		p.column = pos.Column
+		first = p.leadingComments(pos.Line, first)
+		if !first && p.blankBefore(pos.Line) {
+			p.write("\n")
+		}
+		p.newLine()
+		p.line = pos.Line
+		p.statement(stmt)
+		if last := lastLine(stmt); last > p.line {
+			p.line = last
+		}
+		p.trailingComments()
+		first = false
+	}
+	p.limit, p.column = limit, column
+}
+
+// leadingComments : prints the comments that come before a line, each on a
+// line of its own, returning whether nothing has been printed in the block
+func (p *printer) leadingComments(line int, first bool) bool {
+	for len(p.comments) > 0 && p.comments[0].Line < line {
+		c := p.comments[0]
+		if !first && p.blankBefore(c.Line) {
+			p.write("\n")
+		}
+		p.newLine()
+		p.comment(c)
+		first = false
+	}
+	return first
+}
+
+// trailingComments : prints the comments that follow the code printed last
+// at the end of the current line
+func (p *printer) trailingComments() {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if !c.Inline || c.Line > p.line || c.Line >= p.limit {
+			return
+		}
+		p.write(" ")
+		p.comment(c)
+	}
+}
+
+// flushComments : prints the comments on their own lines before line that
+// are indented further than column, which are taken to belong to the end
+// of the block being printed
+func (p *printer) flushComments(line int, column int) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if c.Line >= line || c.Column <= column || (c.Inline && column >= 0) {
+			return
+		}
+		if p.blankBefore(c.Line) {
+			p.write("\n")
+		}
+		p.newLine()
+		p.comment(c)
+	}
+}
+
+func (p *printer) comment(c lex.Comment) {
+	p.write("#", c.Text, "#")
+	p.comments = p.comments[1:]
+	p.line = c.Line + strings.Count(c.Text, "\n")
+}
+
+// block : prints the statements of a block indented, followed by the token
+// that closes it. end is the line the block's last statement is followed
+// by, as far as is known.
+func (p *printer) block(block *ast.Block, closer string, end int) {
+	limit := p.limit
+	p.limit = end
+	p.line = block.Token.Line
+	p.trailingComments()
+	p.depth++
+	p.statements(block.Statements)
+	p.flushComments(end, p.column)
+	p.depth--
+	p.limit = limit
+	// the closing token is taken to be on the line after the block's contents
+	if len(block.Statements) > 0 || p.line > block.Token.Line {
+		p.line++
+	}
+	p.newLine()
+	p.write(closer)
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.VarStatement:
+		p.write("v: ", stmt.Name.Value, " = ")
+		p.expression(stmt.Value)
+	case *ast.AssignStatement:
+		p.expression(stmt.Target)
+		p.write(" = ")
+		p.expression(stmt.Value)
+	case *ast.ImportStatement:
+		p.write("import \"", stmt.Path, "\"")
+		if stmt.Aliased {
+			p.write(" as ", stmt.Name.Value)
+		}
+	case *ast.ReturnStatement:
+		p.write("r: ")
+		p.expression(stmt.ReturnValue)
+	case *ast.BreakStatement:
+		p.write("break")
+	case *ast.ContinueStatement:
+		p.write("continue")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+	}
+}
+
+// precedence of the operators of the language, as the parser has them
+const (
+	lowest = iota
+	logical
+	comparison
+	simpleArith
+	complexArith
+	power
+	prefix
+	postfix // calls and indexing
+)
+
+var infixPrecedence = map[string]int{
+	"&": logical, "|": logical,
+	"==": comparison, "!=": comparison, "<": comparison, ">": comparison, "<=": comparison, ">=": comparison,
+	"+": simpleArith, "-": simpleArith,
+	"*": complexArith, "/": complexArith, "%": complexArith,
+	"^": power,
+}
+
+// precedenceOf : how tightly an expression holds together; operands that
+// hold together less tightly than their operator must be parenthesized
+func precedenceOf(x ast.Expression) int {
+	switch x := x.(type) {
+	case *ast.InfixExpression:
+		return infixPrecedence[x.Operator]
+	case *ast.PrefixExpression:
+		return prefix
+	}
+	return postfix
+}
+
+// operand : prints an operand, parenthesized if it needs to be
+func (p *printer) operand(x ast.Expression, parenthesize bool) {
+	if parenthesize {
+		p.write("(")
+		p.expression(x)
+		p.write(")")
+	} else {
+		p.expression(x)
+	}
+}
+
+func (p *printer) expressions(xs []ast.Expression) {
+	for k, x := range xs {
+		if k > 0 {
+			p.write(", ")
+		}
+		p.expression(x)
+	}
+}
+
+func (p *printer) expression(x ast.Expression) {
+	switch x := x.(type) {
+	case *ast.Identifier:
+		p.write(x.Value)
+	case *ast.IntegerLiteral:
+		p.write(x.Token.Literal)
+	case *ast.FloatingLiteral:
+		p.write(x.Token.Literal)
+	case *ast.BooleanLiteral:
+		if x.Value {
+			p.write("true")
+		} else {
+			p.write("false")
+		}
+	case *ast.StringLiteral:
+		p.write(`"`, x.Value, `"`)
+	case *ast.PrefixExpression:
+		p.write(x.Operator)
+		p.operand(x.RightExpression, precedenceOf(x.RightExpression) < prefix)
+	case *ast.InfixExpression:
+		// ^ groups to the right and all the other operators to the left
+		prec := infixPrecedence[x.Operator]
+		left, right := precedenceOf(x.LeftExpression), precedenceOf(x.RightExpression)
+		p.operand(x.LeftExpression, left < prec || (left == prec && x.Operator == "^"))
+		p.write(" ", x.Operator, " ")
+		p.operand(x.RightExpression, right < prec || (right == prec && x.Operator != "^"))
+	case *ast.FunctionCallExpression:
+		p.operand(x.Function, precedenceOf(x.Function) < postfix)
+		p.write("(")
+		p.expressions(x.Arguments)
+		p.write(")")
+	case *ast.ArrayIndexExpression:
+		p.operand(x.LeftExpression, precedenceOf(x.LeftExpression) < postfix)
+		p.write("[")
+		p.expression(x.Index)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.operand(x.LeftExpression, precedenceOf(x.LeftExpression) < postfix)
+		p.write(".", x.Member.Value)
+	case *ast.Array:
+		p.write("[")
+		p.expressions(x.Elements)
+		p.write("]")
+	case *ast.Map:
+		p.write("{")
+		for k := range x.Keys {
+			if k > 0 {
+				p.write(", ")
+			}
+			p.expression(x.Keys[k])
+			p.write(" = ")
+			p.expression(x.Values[k])
+		}
+		p.write("}")
+	case *ast.FunctionExpression:
+		p.write("f(")
+		for k, param := range x.Params {
+			if k > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+		}
+		p.write("):")
+		p.block(x.FuncBody, ":f", p.limit)
+	case *ast.IfExpression:
+		p.write("i (")
+		p.expression(x.Condition)
+		p.write("):")
+		if x.ElseBody == nil {
+			p.block(x.IfBody, ":i", p.limit)
+			return
+		}
+		p.block(x.IfBody, ":i", x.ElseBody.Token.Line)
+		p.write(" e:")
+		p.block(x.ElseBody, ":e", p.limit)
+	case *ast.LoopExpression:
+		p.write("l (")
+		p.expression(x.Condition)
+		p.write("):")
+		p.block(x.LoopBody, ":l", p.limit)
+	case *ast.ForEachExpression:
+		p.write("l (")
+		if x.Key != nil {
+			p.write(x.Key.Value, ", ")
+		}
+		p.write(x.Value.Value, " in ")
+		p.expression(x.Collection)
+		p.write("):")
+		p.block(x.LoopBody, ":l", p.limit)
+	case *ast.TryExpression:
+		p.write("t:")
+		p.block(x.TryBody, ":t", x.ErrName.Token.Line)
+		p.write(" c (", x.ErrName.Value, "):")
+		p.block(x.CatchBody, ":c", p.limit)
+	}
+}
+
+// lastLine : the last line a node has a token on. Nodes do not record the
+// tokens that close blocks, so the lines of those are not included.
+func lastLine(node ast.Node) int {
+	last := node.Pos().Line
+	ast.Inspect(node, func(n ast.Node) bool {
+		if line := n.Pos().Line; line > last {
+			last = line
+		}
+		return true
+	})
+	return last
+}
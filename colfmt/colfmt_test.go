@@ -0,0 +1,77 @@
+package colfmt
+
+import (
+	ast "colon/colast"
+	lex "colon/collex"
+	par "colon/colparc"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// format : parses and formats code, returning the formatted source and the
+// program it was formatted from
+func format(t *testing.T, code string) (string, *ast.Program) {
+	t.Helper()
+	lexer := lex.CreateLexerState(code)
+	tokens := lexer.Lex()
+	if errs := lexer.Errors(); len(errs) > 0 {
+		t.Fatalf("%q does not lex: %v", code, errs[0])
+	}
+	lines := lexer.SourceLines()
+	parser := par.CreateParserState(tokens, lines)
+	program := parser.Parse()
+	if errs := parser.Errors(); len(errs) > 0 {
+		t.Fatalf("%q does not parse: %v", code, errs[0])
+	}
+	return Format(program, lexer.Comments(), lines), program
+}
+
+// checkRoundTrip : formatting code must not change its syntax tree, and
+// formatting the result again must not change it
+func checkRoundTrip(t *testing.T, code string) string {
+	t.Helper()
+	once, program := format(t, code)
+	twice, formatted := format(t, once)
+	if formatted.String() != program.String() {
+		t.Errorf("formatting %q changed its syntax tree:\n%s\nbecame\n%s", code, program, formatted)
+	}
+	if twice != once {
+		t.Errorf("formatting %q is not idempotent:\n%q\nbecame\n%q", code, once, twice)
+	}
+	return once
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		code string
+		want string
+	}{
+		{"v: a=1+2*3\n", "v: a = 1 + 2 * 3\n"},
+		{"v: s = \"héllo, 世界\"\nprint(s)\n", "v: s = \"héllo, 世界\"\nprint(s)\n"},
+		{"v: q = \"say \\\"hi\\\"\"\n", "v: q = \"say \\\"hi\\\"\"\n"},
+		{"v: a = 1\n\n\n\nprint(a)\n", "v: a = 1\n\nprint(a)\n"},
+		{"i(a>1):\nprint(a)\n:i\n", "i (a > 1):\n    print(a)\n:i\n"},
+		{"v: a = 1 # one #\n", "v: a = 1 # one #\n"},
+		{"# héllo #\nprint(1)\n", "# héllo #\nprint(1)\n"},
+	}
+	for _, tc := range cases {
+		if got := checkRoundTrip(t, tc.code); got != tc.want {
+			t.Errorf("%q : got %q, want %q", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestFormatTestCode(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "test-code", "*.col"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		code, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkRoundTrip(t, string(code))
+	}
+}
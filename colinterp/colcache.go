@@ -0,0 +1,177 @@
+package colinterp
+
+import (
+	"bufio"
+	"bytes"
+	ast "colon/colast"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// CacheExtension : the extension of AST cache files. The cache of foo.col
+// is foo.colc, next to it.
+const CacheExtension = ".colc"
+
+// cacheMagic : the first bytes of every AST cache file
+const cacheMagic = "COLC"
+
+// Cache : a parsed program stored with the hash of the source it was parsed
+// from, so that it can be run without lexing or parsing that source again.
+// An AST cache file holds the magic bytes, the encoding version, the hash,
+// the source lines (for error messages) and the encoded program, in order.
+type Cache struct {
+	Hash    [sha256.Size]byte
+	Lines   []string
+	Program *ast.Program
+}
+
+// CachePath : the path of the AST cache for a source file
+func CachePath(filename string) string {
+	return strings.TrimSuffix(filename, ".col") + CacheExtension
+}
+
+// SourcePath : the path of the source file an AST cache was built from
+func SourcePath(cachename string) string {
+	return strings.TrimSuffix(cachename, CacheExtension) + ".col"
+}
+
+// NewCache : parses code into a cache. Errors are those of Parse.
+func NewCache(code string) (*Cache, error) {
+	program, err := Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{
+		Hash:    sha256.Sum256([]byte(code)),
+		Lines:   program.Lines,
+		Program: program,
+	}, nil
+}
+
+// Fresh : reports whether the cache was built from exactly this code
+func (c *Cache) Fresh(code string) bool {
+	return c.Hash == sha256.Sum256([]byte(code))
+}
+
+// Build : parses a source file and writes its AST cache, returning the
+// path of the cache
+func Build(filename string) (string, error) {
+	code, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	cache, err := NewCache(string(code))
+	if err != nil {
+		return "", err
+	}
+	cachename := CachePath(filename)
+	f, err := os.Create(cachename)
+	if err != nil {
+		return "", err
+	}
+	if err := cache.Write(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	return cachename, f.Close()
+}
+
+// Write : writes the cache in the AST cache file format
+func (c *Cache) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(cacheMagic)
+	writeUvarint(bw, ast.EncodingVersion)
+	bw.Write(c.Hash[:])
+	writeUvarint(bw, uint64(len(c.Lines)))
+	for _, line := range c.Lines {
+		writeUvarint(bw, uint64(len(line)))
+		bw.WriteString(line)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return ast.Encode(w, c.Program)
+}
+
+func writeUvarint(w *bufio.Writer, n uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	w.Write(buf[:binary.PutUvarint(buf, n)])
+}
+
+// ReadCache : reads a cache written by Cache.Write. Caches written by a
+// different version of colon are rejected, as are those whose lengths run
+// past the end of the cache.
+func ReadCache(r io.Reader) (*Cache, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	br := bytes.NewReader(data)
+	magic := make([]byte, len(cacheMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, []byte(cacheMagic)) {
+		return nil, fmt.Errorf("not an AST cache")
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if version != ast.EncodingVersion {
+		return nil, fmt.Errorf("AST cache has format version %d, expected %d; rebuild it", version, ast.EncodingVersion)
+	}
+	cache := &Cache{}
+	if _, err := io.ReadFull(br, cache.Hash[:]); err != nil {
+		return nil, err
+	}
+	// every line takes at least the byte of its length
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(br.Len()) {
+		return nil, fmt.Errorf("AST cache is truncated")
+	}
+	for k := uint64(0); k < count; k++ {
+		length, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(br.Len()) {
+			return nil, fmt.Errorf("AST cache is truncated")
+		}
+		line := make([]byte, length)
+		if _, err := io.ReadFull(br, line); err != nil {
+			return nil, err
+		}
+		cache.Lines = append(cache.Lines, string(line))
+	}
+	if cache.Program, err = ast.Decode(br); err != nil {
+		return nil, err
+	}
+	cache.Program.Lines = cache.Lines
+	return cache, nil
+}
+
+// ReadCacheFile : reads the AST cache file at a path
+func ReadCacheFile(cachename string) (*Cache, error) {
+	f, err := os.Open(cachename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCache(f)
+}
+
+// FreshCache : returns the AST cache of a source file if there is one that
+// was built from the given code, or nil
+func FreshCache(filename string, code string) *Cache {
+	cache, err := ReadCacheFile(CachePath(filename))
+	if err != nil || !cache.Fresh(code) {
+		return nil
+	}
+	return cache
+}
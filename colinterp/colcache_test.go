@@ -0,0 +1,101 @@
+package colinterp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const cachedCode = "v: xs = [1, 2, 3]\nprint(len(xs))\n"
+
+func encodedCache(t *testing.T) []byte {
+	cache, err := NewCache(cachedCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cache.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadCacheRejectsTruncated(t *testing.T) {
+	data := encodedCache(t)
+	if _, err := ReadCache(bytes.NewReader(data)); err != nil {
+		t.Fatalf("cannot read a whole cache: %v", err)
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := ReadCache(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("read a cache cut to %d of %d bytes", n, len(data))
+		}
+	}
+}
+
+func TestReadCacheRejectsHugeLengths(t *testing.T) {
+	data := encodedCache(t)
+	huge := make([]byte, binary.MaxVarintLen64)
+	huge = huge[:binary.PutUvarint(huge, 1<<40)]
+	// the count of lines follows the magic, the version and the hash
+	at := len(cacheMagic) + 1 + 32
+	for _, offset := range []int{at, at + 1} {
+		corrupt := append(append(append([]byte{}, data[:offset]...), huge...), data[offset+1:]...)
+		if _, err := ReadCache(bytes.NewReader(corrupt)); err == nil {
+			t.Errorf("read a cache with a length of 1<<40 at byte %d", offset)
+		}
+	}
+	// and the length of the name xs in the encoded program, a signed varint
+	offset := bytes.LastIndex(data, []byte("\x04xs"))
+	if offset < 0 {
+		t.Fatal("the encoded program does not hold the name xs")
+	}
+	huge = huge[:binary.PutVarint(huge[:cap(huge)], 1<<30)]
+	corrupt := append(append(append([]byte{}, data[:offset]...), huge...), data[offset+1:]...)
+	if _, err := ReadCache(bytes.NewReader(corrupt)); err == nil {
+		t.Errorf("read a cache with a length of 1<<30 in its program")
+	}
+}
+
+func TestFreshCacheIgnoresCorruptCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "s.col")
+	data := encodedCache(t)
+	if err := ioutil.WriteFile(CachePath(filename), data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cache := FreshCache(filename, cachedCode); cache != nil {
+		t.Errorf("a corrupt cache was taken as fresh")
+	}
+}
+
+// TestRunCacheShowsSource : runtime errors in a cached program quote its
+// source on both engines, though the source is never parsed
+func TestRunCacheShowsSource(t *testing.T) {
+	cache, err := NewCache("v: x = 1\n\nprint(x / 0)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cache.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, useVM := range []bool{false, true} {
+		read, err := ReadCache(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt := NewRuntime(Config{Stdout: ioutil.Discard, VM: useVM})
+		_, err = rt.RunCache("s.col", read)
+		if err == nil || !strings.Contains(err.Error(), "\tprint(x / 0)") {
+			t.Errorf("vm %v: got %v, want an error quoting its line", useVM, err)
+		}
+	}
+}
@@ -1,36 +1,83 @@
 package colinterp
 
 import (
-	evl "colon/coleval"
+	ast "colon/colast"
+	frm "colon/colfmt"
 	lex "colon/collex"
-	obj "colon/colobj"
 	par "colon/colparc"
-	"fmt"
-	"os"
+	"strings"
 )
 
-// Interpret : the colon interpreter
-func Interpret(code string) {
+// ErrorList : the errors reported by a single stage of the interpreter
+type ErrorList []error
+
+func (el ErrorList) Error() string {
+	msgs := []string{}
+	for _, e := range el {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n\n")
+}
+
+// Interpret : the colon interpreter, running code against the process's
+// stdin and stdout. See Runtime.Run for the errors it returns.
+func Interpret(code string) error {
+	_, err := NewRuntime(Config{}).Run(code)
+	return err
+}
+
+// InterpretFile : like Interpret, for code read from the named file
+func InterpretFile(filename string, code string) error {
+	_, err := NewRuntime(Config{}).RunFile(filename, code)
+	return err
+}
+
+// Parse : lexes and parses code. Lexing and parsing errors are returned
+// as an ErrorList of *collex.LexError or *colparc.ParseError values.
+func Parse(code string) (*ast.Program, error) {
+	program, _, err := parse(code)
+	return program, err
+}
+
+// Format : the canonical source of code, comments included (see
+// colfmt.Format). Errors are those of Parse.
+func Format(code string) (string, error) {
+	program, lexer, err := parse(code)
+	if err != nil {
+		return "", err
+	}
+	return frm.Format(program, lexer.Comments(), lexer.SourceLines()), nil
+}
+
+// parse : lexes and parses code, returning the lexer as well, for the
+// comments and source lines it found
+func parse(code string) (*ast.Program, *lex.Lexer, error) {
 	// LEXING
 	lexer := lex.CreateLexerState(code)
 	tokens := lexer.Lex()
 
+	// LEX-ERROR CHECKING
+	if lexErrors := lexer.Errors(); len(lexErrors) > 0 {
+		el := ErrorList{}
+		for _, v := range lexErrors {
+			el = append(el, v)
+		}
+		return nil, nil, el
+	}
+
 	// PARSING
 	parser := par.CreateParserState(tokens, lexer.SourceLines())
 	program := parser.Parse()
-	parseErrors := parser.ReportErrors()
 
 	// PARSE-ERROR CHECKING
-	if parseErrors[0] != "None" {
+	if parseErrors := parser.Errors(); len(parseErrors) > 0 {
+		el := ErrorList{}
 		for _, v := range parseErrors {
-			fmt.Println(v)
+			el = append(el, v)
 		}
-		os.Exit(22)
+		return nil, nil, el
 	}
-
-	// EVALUATION
-	env := obj.NewEnv()
-	evl.Eval(program, env)
+	return program, lexer, nil
 }
 
 /*
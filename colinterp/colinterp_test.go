@@ -0,0 +1,151 @@
+package colinterp
+
+import (
+	"bytes"
+	evl "colon/coleval"
+	lex "colon/collex"
+	par "colon/colparc"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpretErrors(t *testing.T) {
+	var el ErrorList
+	if err := Interpret("v: a = 1 $ 2\n"); !errors.As(err, &el) {
+		t.Fatalf("lex error : got %T, want ErrorList", err)
+	} else if _, ok := el[0].(*lex.LexError); !ok {
+		t.Errorf("lex error : got %T, want *collex.LexError", el[0])
+	}
+
+	if err := Interpret("print(\n"); !errors.As(err, &el) {
+		t.Fatalf("parse error : got %T, want ErrorList", err)
+	} else if _, ok := el[0].(*par.ParseError); !ok {
+		t.Errorf("parse error : got %T, want *colparc.ParseError", el[0])
+	}
+
+	var re *evl.RuntimeError
+	if err := Interpret("print(1)\nprint(nope)\n"); !errors.As(err, &re) {
+		t.Fatalf("runtime error : got %T, want *coleval.RuntimeError", err)
+	} else if re.Line != 2 {
+		t.Errorf("runtime error : got line %d, want 2", re.Line)
+	}
+}
+
+func TestInterpretRecursionLimit(t *testing.T) {
+	code := "v: g = f(n):\n    r: g(n + 1)\n:f\ng(0)\n"
+	var re *evl.RuntimeError
+	if err := Interpret(code); !errors.As(err, &re) {
+		t.Fatalf("got %v, want a runtime error", err)
+	} else if !strings.Contains(re.Msg, "too many nested calls") {
+		t.Errorf("got %q", re.Msg)
+	}
+
+	// the depth goes back down once the error has unwound
+	if err := Interpret("v: g = f(n):\n    r: n\n:f\nprint(g(1))\n"); err != nil {
+		t.Errorf("after the limit : %v", err)
+	}
+}
+
+// engineCase : a program run on both the evaluator and the VM, which must
+// print the same output and fail with the same error
+type engineCase struct {
+	name   string
+	file   string // a program in test-code, run in place of code if set
+	code   string
+	stdin  string
+	output string
+	err    string // part of the error the program fails with, "" if it must not fail
+}
+
+var engineCases = []engineCase{
+	{name: "comments", file: "comments.col", output: "This is a program to test comments in colon\nhello\n"},
+	{name: "fibonacci", file: "fibonacchi.col", stdin: "10\n", output: "0\n1\n1\n2\n3\n5\n8\n13\n21\n34\n"},
+	{name: "sum arrays", file: "sumArrays.col", stdin: "3\n4\n5\n6\n",
+		output: "Enter a number:\narray is :\n[4, 5, 6]\nsum is:\n15\nRecursively adding array elements:\n15\n"},
+	{name: "sum to num", file: "sumToNum.col", output: "15\n15\n"},
+	{name: "bad integer", file: "fibonacchi.col", stdin: "ten\n", err: `readInt : "ten" is not an integer`},
+
+	{name: "booleans from builtins", code: "v: m = {\"x\" = 1}\nprint(has(m, \"x\") == true)\nprint(has(m, \"y\") != false)\n",
+		output: "true\nfalse\n"},
+	{name: "many arguments", code: "print(" + strings.TrimSuffix(strings.Repeat("1, ", 300), ", ") + ")\n",
+		output: strings.Repeat("1\n", 300)},
+	{name: "try and catch", code: "v: x = t:\n    1 / 0\n:t c (err):\n    print(err[\"message\"])\n    7\n:c\nprint(x)\n",
+		output: "integer division by zero\n7\n"},
+	{name: "math module", code: "import \"math\"\nprint(math.floor(2.5) + 2 ^ -1)\nprint(7.5 % 2)\n", output: "2.5\n1.5\n"},
+	{name: "list builtins", code: "print(map(range(4), f(x):\n    r: x * x\n:f))\nprint(reduce([1, 2, 3], f(a, b):\n    r: a + b\n:f))\n",
+		output: "[0, 1, 4, 9]\n6\n"},
+	{name: "t and c as names", code: "v: t = 2\nv: c = [t, t]\nprint(t * len(c))\n", output: "4\n"},
+
+	{name: "division by zero", code: "v: x = 1\n\nprint(x / 0)\n",
+		err: "Runtime Error on line 3, column 9 : integer division by zero\n\n\tprint(x / 0)"},
+	{name: "undefined name", code: "print(y)\n", err: `variable "y" not initialized`},
+	{name: "error in a function", code: "v: g = f(x):\n    r: x / 0\n:f\ng(1)\n",
+		err: "on line 2, column 10 : integer division by zero\n\n\t    r: x / 0"},
+	{name: "huge range", code: "v: xs = range(0, 3000000000)\n", err: "range cannot make a list of 3000000000 numbers"},
+	{name: "error in a mapped function", code: "map([1, 0], f(x):\n    r: 1 / x\n:f)\n", err: "on line 2, column 10 : integer division by zero"},
+	{name: "infinite recursion", code: "v: g = f(x):\n    r: g(x + 1)\n:f\ng(0)\n", err: "too many nested calls"},
+}
+
+// runOn : runs code, as the named file, on the evaluator or the VM, and
+// returns what it printed and the error it failed with
+func runOn(useVM bool, filename string, code string, stdin string) (string, error) {
+	var out bytes.Buffer
+	rt := NewRuntime(Config{Stdin: strings.NewReader(stdin), Stdout: &out, VM: useVM})
+	_, err := rt.RunFile(filename, code)
+	return out.String(), err
+}
+
+func TestEngines(t *testing.T) {
+	for _, tc := range engineCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code := tc.code
+			if tc.file != "" {
+				data, err := ioutil.ReadFile(filepath.Join("..", "test-code", tc.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				code = string(data)
+			}
+			evalOut, evalErr := runOn(false, tc.file, code, tc.stdin)
+			vmOut, vmErr := runOn(true, tc.file, code, tc.stdin)
+
+			if evalOut != vmOut {
+				t.Errorf("the evaluator printed %q, the VM %q", evalOut, vmOut)
+			}
+			if errorText(evalErr) != errorText(vmErr) {
+				t.Errorf("the evaluator failed with %q, the VM with %q", errorText(evalErr), errorText(vmErr))
+			}
+			if tc.output != "" && evalOut != tc.output {
+				t.Errorf("printed %q, want %q", evalOut, tc.output)
+			}
+			switch {
+			case tc.err == "" && evalErr != nil:
+				t.Errorf("failed with %q", evalErr)
+			case tc.err != "" && evalErr == nil:
+				t.Errorf("did not fail, want an error with %q", tc.err)
+			case tc.err != "" && !strings.Contains(evalErr.Error(), tc.err):
+				t.Errorf("failed with %q, want an error with %q", evalErr, tc.err)
+			}
+		})
+	}
+}
+
+// TestCompileOperandWidth : a list literal with more elements than its
+// operand holds is a compile error, not a silently truncated count
+func TestCompileOperandWidth(t *testing.T) {
+	code := "v: x = 0\nv: xs = [" + strings.TrimSuffix(strings.Repeat("x, ", 70000), ", ") + "]\n"
+	_, err := runOn(true, "", code, "")
+	if err == nil || !strings.Contains(err.Error(), "too large to compile") {
+		t.Errorf("got %v, want a too large to compile error", err)
+	}
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,132 @@
+package colinterp
+
+import (
+	evl "colon/coleval"
+	lex "colon/collex"
+	obj "colon/colobj"
+	par "colon/colparc"
+	vm "colon/colvm"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModuleExtension : the extension of colon source files, which may be left
+// out of the paths of imports
+const ModuleExtension = ".col"
+
+// importModule : the Importer of the runtime's evaluator. A module is run
+// the first time it is imported, in an env of its own that sees only the
+// builtins and the bindings made by the host, and every later import of the
+// same file gets the same module.
+func (rt *Runtime) importModule(path string, from *obj.Module) *obj.Module {
+	dir := filepath.Dir(rt.file)
+	if from != nil {
+		dir = filepath.Dir(from.Path)
+	}
+	file, err := rt.findModule(path, dir)
+	if err != nil {
+		evl.ReportError(err.Error())
+	}
+	key, err := filepath.Abs(file)
+	if err != nil {
+		key = file
+	}
+	if module, ok := rt.modules[key]; ok {
+		return module
+	}
+	for k, loading := range rt.loading {
+		if loading == key {
+			cycle := []string{}
+			for _, f := range append(rt.loading[k:], key) {
+				cycle = append(cycle, filepath.Base(f))
+			}
+			evl.ReportError("import cycle : " + strings.Join(cycle, " -> "))
+		}
+	}
+
+	code, err := ioutil.ReadFile(file)
+	if err != nil {
+		evl.ReportError(fmt.Sprintf("cannot import %q : %s", path, err))
+	}
+	cache := FreshCache(file, string(code))
+	if cache == nil {
+		cache, err = NewCache(string(code))
+	}
+	if err != nil {
+		evl.ReportError(fmt.Sprintf("cannot import %q, which has errors :\n\n%s", path, errorSummary(err)))
+	}
+
+	module := &obj.Module{Path: file, Lines: cache.Lines, Env: obj.NewInnerEnv(rt.host)}
+	rt.loading = append(rt.loading, key)
+	defer func() { rt.loading = rt.loading[:len(rt.loading)-1] }()
+	if rt.machine != nil {
+		machine := vm.New(rt.eval)
+		main, err := machine.Compile(cache.Program)
+		if err != nil {
+			evl.ReportError(err.Error())
+		}
+		if _, err := machine.RunModule(main, module); err != nil {
+			panic(err)
+		}
+	} else {
+		rt.eval.EvalModule(cache.Program, module)
+	}
+	rt.modules[key] = module
+	return module
+}
+
+// findModule : the file an import of path refers to. An absolute path is
+// used as it is; any other path is looked for in dir, the directory of the
+// importing file, and then in the directories of the runtime's module path.
+// Every file looked at must be one the runtime's file access lets code reach.
+func (rt *Runtime) findModule(path string, dir string) (string, error) {
+	names := []string{path}
+	if filepath.Ext(path) == "" {
+		names = append(names, path+ModuleExtension)
+	}
+	dirs := append([]string{dir}, rt.modulePath...)
+	if filepath.IsAbs(path) {
+		dirs = []string{""}
+	}
+	for _, d := range dirs {
+		for _, name := range names {
+			file := filepath.Join(d, name)
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				abs = file
+			}
+			if _, err := rt.eval.FilePath(abs); err == evl.ErrOutsideRoot {
+				return "", fmt.Errorf("cannot import %q : it is %s", path, err)
+			} else if err != nil {
+				return "", fmt.Errorf("cannot import %q : %s", path, err)
+			}
+			if info, err := os.Stat(file); err == nil && !info.IsDir() {
+				return file, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("module %q not found in %s", path, strings.Join(dirs, ", "))
+}
+
+// errorSummary : the lexing and parsing errors of a module, without the
+// lines of the module they are on, so that importing a file that is not
+// colon code does not show what it holds
+func errorSummary(err error) string {
+	el, ok := err.(ErrorList)
+	if !ok {
+		return err.Error()
+	}
+	msgs := []string{}
+	for _, e := range el {
+		switch e := e.(type) {
+		case *lex.LexError:
+			msgs = append(msgs, fmt.Sprintf("line %d, column %d : %s", e.Line, e.Column, e.Msg))
+		case *par.ParseError:
+			msgs = append(msgs, fmt.Sprintf("line %d, column %d : %s", e.Line, e.Column, e.Msg))
+		}
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,132 @@
+package colinterp
+
+import (
+	evl "colon/coleval"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// moduleDir : a temporary directory holding the given files, removed by
+// the returned function
+func moduleDir(t *testing.T, files map[string]string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "colmodule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestImport(t *testing.T) {
+	dir, remove := moduleDir(t, map[string]string{
+		"lib.col":       "v: y = 7\nv: twice = f(x):\n    r: x * 2\n:f\n",
+		"t.col":         "v: y = 1\n",
+		"count.col":     "print(\"loaded\")\nv: n = 1\n",
+		"a.col":         "import \"b\"\n",
+		"b.col":         "import \"a\"\n",
+		"fails.col":     "v: g = f(x):\n    r: x / 0\n:f\n",
+		"sub/inner.col": "v: z = 3\n",
+	})
+	defer remove()
+	main := filepath.Join(dir, "main.col")
+
+	cases := []struct {
+		name   string
+		code   string
+		output string
+		err    string
+	}{
+		{"members", "import \"lib\"\nprint(lib.twice(lib.y))\n", "14\n", ""},
+		{"alias", "import \"lib.col\" as m\nprint(m.y)\n", "7\n", ""},
+		{"named t", "import \"t\"\nprint(t.y)\n", "1\n", ""},
+		{"subdirectory", "import \"sub/inner\"\nprint(inner.z)\n", "3\n", ""},
+		{"runs once", "import \"count\"\nimport \"count\" as again\nprint(again.n)\n", "loaded\n1\n", ""},
+		{"cycle", "import \"a\"\n", "", "import cycle : a.col -> b.col -> a.col"},
+		{"not found", "import \"nowhere\"\n", "", `module "nowhere" not found`},
+		{"missing member", "import \"lib\"\nprint(lib.w)\n", "", `"w"`},
+		{"error in a module", "import \"fails\"\nfails.g(1)\n", "",
+			"fails.col on line 2, column 10 : integer division by zero\n\n\t    r: x / 0"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, useVM := range []bool{false, true} {
+				var out strings.Builder
+				rt := NewRuntime(Config{Stdout: &out, VM: useVM})
+				_, err := rt.RunFile(main, tc.code)
+				if out.String() != tc.output {
+					t.Errorf("vm %v: printed %q, want %q", useVM, out.String(), tc.output)
+				}
+				switch {
+				case tc.err == "" && err != nil:
+					t.Errorf("vm %v: failed with %q", useVM, err)
+				case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+					t.Errorf("vm %v: failed with %v, want an error with %q", useVM, err, tc.err)
+				}
+			}
+		})
+	}
+}
+
+func TestImportFileAccess(t *testing.T) {
+	dir, remove := moduleDir(t, map[string]string{
+		"root/lib.col": "v: y = 7\n",
+		"secret.txt":   "token: {hunter}\n",
+	})
+	defer remove()
+	root := filepath.Join(dir, "root")
+	secret := filepath.Join(dir, "secret.txt")
+	main := filepath.Join(root, "main.col")
+	linked := os.Symlink(dir, filepath.Join(root, "up")) == nil
+
+	type importCase struct {
+		name   string
+		files  evl.FileAccess
+		code   string
+		output string
+		err    string
+	}
+	cases := []importCase{
+		{"next to the file", evl.FileAccess{}, "import \"lib\" as m\nprint(m.y)\n", "7\n", ""},
+		{"under the root", evl.FileAccess{Root: root}, "import \"lib\" as m\nprint(m.y)\n", "7\n", ""},
+		{"outside the root", evl.FileAccess{Root: root}, "import \"" + secret + "\" as s\n", "", "it is outside the directory"},
+		{"up out of the root", evl.FileAccess{Root: root}, "import \"../secret.txt\" as s\n", "", "it is outside the directory"},
+		{"disabled", evl.FileAccess{Disabled: true}, "import \"lib\" as m\n", "", "file access is disabled"},
+		{"standard module", evl.FileAccess{Disabled: true}, "import \"math\"\nprint(math.floor(2.5))\n", "2\n", ""},
+		{"not colon code", evl.FileAccess{}, "import \"" + secret + "\" as s\n", "", "which has errors"},
+	}
+	if linked {
+		cases = append(cases, importCase{"through a link", evl.FileAccess{Root: root}, "import \"up/secret.txt\" as s\n", "", "it is outside the directory"})
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, useVM := range []bool{false, true} {
+				var out strings.Builder
+				rt := NewRuntime(Config{Stdout: &out, VM: useVM, Files: tc.files})
+				_, err := rt.RunFile(main, tc.code)
+				if out.String() != tc.output {
+					t.Errorf("printed %q, want %q", out.String(), tc.output)
+				}
+				switch {
+				case tc.err == "" && err != nil:
+					t.Errorf("failed with %q", err)
+				case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+					t.Errorf("failed with %v, want an error with %q", err, tc.err)
+				case err != nil && strings.Contains(err.Error(), "hunter"):
+					t.Errorf("the error shows what the imported file holds : %q", err)
+				}
+			}
+		})
+	}
+}
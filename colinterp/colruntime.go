@@ -0,0 +1,195 @@
+package colinterp
+
+import (
+	ast "colon/colast"
+	chk "colon/colcheck"
+	evl "colon/coleval"
+	obj "colon/colobj"
+	vm "colon/colvm"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Config : options for creating a Runtime. Stdin and Stdout default to the
+// process's stdin and stdout when left nil. readLine, readInt and readFloat
+// share one buffered reader over Stdin, which is Stdin itself when it is a
+// *bufio.Reader, so the host can read from it too without losing input.
+type Config struct {
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Globals map[string]obj.Object // bound in the runtime's global env before any code runs
+	VM      bool                  // compile code to bytecode and run it on the VM, instead of walking the syntax tree
+
+	// ModulePath : directories searched for imported modules that are not
+	// found next to the file importing them, in order
+	ModulePath []string
+
+	// Files : which files the file builtins (readFile, writeFile and the
+	// like) and imports may reach. Left zero, they reach every file the
+	// process can; scripts that are not trusted should get Disabled or a
+	// Root. The standard modules can be imported either way.
+	Files evl.FileAccess
+}
+
+// Runtime : an embeddable colon interpreter. Every call to Run shares the
+// same global env, so bindings made by one run are visible to the next.
+type Runtime struct {
+	eval    *evl.Evaluator
+	machine *vm.VM // nil when code is run by the evaluator
+	env     *obj.Env
+	host    *obj.Env // the bindings made by the host, which modules see as well
+
+	file       string                 // the file being run, which imports are relative to
+	modulePath []string               // see Config.ModulePath
+	modules    map[string]*obj.Module // the modules imported so far, by absolute path
+	loading    []string               // the modules being imported, outermost first
+}
+
+// NewRuntime : to create a new runtime from a config
+func NewRuntime(config Config) *Runtime {
+	stdin, stdout := config.Stdin, config.Stdout
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	rt := &Runtime{
+		eval:       evl.NewEvaluator(stdin, stdout),
+		env:        obj.NewEnv(),
+		host:       obj.NewEnv(),
+		modulePath: config.ModulePath,
+		modules:    map[string]*obj.Module{},
+	}
+	rt.eval.SetImporter(rt.importModule)
+	rt.eval.SetFileAccess(config.Files)
+	if config.VM {
+		rt.machine = vm.New(rt.eval)
+	}
+	for name, value := range config.Globals {
+		rt.Define(name, value)
+	}
+	return rt
+}
+
+// Define : binds a host value to a name in the runtime's global env, and
+// in the envs of the modules it imports
+func (rt *Runtime) Define(name string, value obj.Object) {
+	rt.env.Set(name, value)
+	rt.host.Set(name, value)
+}
+
+// Register : makes a Go function callable by name from code run by this
+// runtime. Builtins registered with one runtime are not seen by others.
+func (rt *Runtime) Register(name string, fn obj.BuiltInFunction) {
+	rt.eval.Register(name, fn)
+}
+
+// RegisterBuiltIn : like Register, but the builtin may carry a Signature
+// that calls are checked against before it runs
+func (rt *Runtime) RegisterBuiltIn(name string, bin *obj.BuiltIn) {
+	rt.eval.RegisterBuiltIn(name, bin)
+}
+
+// RegisterFunc : registers any Go func as a builtin, converting arguments
+// and results between Go values and colon objects (see colobj.WrapFunc)
+func (rt *Runtime) RegisterFunc(name string, fn interface{}) error {
+	bin, err := obj.WrapFunc(fn)
+	if err != nil {
+		return err
+	}
+	rt.eval.RegisterBuiltIn(name, bin)
+	return nil
+}
+
+// BuiltinNames : returns the names of the builtins available to the runtime, sorted
+func (rt *Runtime) BuiltinNames() []string {
+	return rt.eval.BuiltinNames()
+}
+
+// Lookup : returns the value bound to a name in the runtime's global env
+func (rt *Runtime) Lookup(name string) (obj.Object, bool) {
+	return rt.env.Get(name)
+}
+
+// Env : returns the runtime's global env
+func (rt *Runtime) Env() *obj.Env {
+	return rt.env
+}
+
+// Run : lexes, parses and evaluates code, returning the value of the last
+// statement. Lexing and parsing errors are returned as an ErrorList, runtime
+// errors as a *coleval.RuntimeError.
+func (rt *Runtime) Run(code string) (result obj.Object, err error) {
+	return rt.RunFile("", code)
+}
+
+// RunFile : like Run, for code read from the named file. Runtime errors
+// name the file they happened in.
+func (rt *Runtime) RunFile(filename string, code string) (result obj.Object, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("internal error: %v", r)
+		}
+	}()
+
+	program, err := Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	return rt.runProgram(filename, program)
+}
+
+// RunCache : like RunFile, for a program loaded from an AST cache of the
+// named file
+func (rt *Runtime) RunCache(filename string, cache *Cache) (result obj.Object, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("internal error: %v", r)
+		}
+	}()
+
+	return rt.runProgram(filename, cache.Program)
+}
+
+// runProgram : evaluates a parsed program, naming the file it came from in
+// runtime errors
+func (rt *Runtime) runProgram(filename string, program *ast.Program) (result obj.Object, err error) {
+	rt.file = filename
+	// EVALUATION
+	if rt.machine != nil {
+		result, err = rt.runOnVM(program)
+	} else {
+		result, err = rt.eval.Run(program, rt.env)
+	}
+	if err != nil {
+		if rerr, ok := err.(*evl.RuntimeError); ok && rerr.File == "" {
+			rerr.File = filename
+		}
+		return nil, err
+	}
+	if result == nil {
+		result = evl.EMPTY
+	}
+	return result, nil
+}
+
+// Check : parses code and checks it for problems without running it, as
+// code run by this runtime. Lexing and parsing errors are returned as for Run.
+func (rt *Runtime) Check(code string) ([]*chk.Diagnostic, error) {
+	program, err := Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	return chk.NewChecker(rt.eval, rt.env).Check(program), nil
+}
+
+// runOnVM : compiles a program to bytecode and runs it on the runtime's VM
+func (rt *Runtime) runOnVM(program *ast.Program) (obj.Object, error) {
+	main, err := rt.machine.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	return rt.machine.Run(main, rt.env)
+}
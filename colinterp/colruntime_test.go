@@ -0,0 +1,180 @@
+package colinterp
+
+import (
+	evl "colon/coleval"
+	obj "colon/colobj"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRuntimeIO(t *testing.T) {
+	var out strings.Builder
+	rt := NewRuntime(Config{
+		Stdin:   strings.NewReader("41\n"),
+		Stdout:  &out,
+		Globals: map[string]obj.Object{"greeting": &obj.String{Value: "hi"}},
+	})
+	if _, err := rt.Run("v: n = readInt()\nprint(greeting)\nprint(n + 1)\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "hi\n42\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRuntimeKeepsGlobals(t *testing.T) {
+	rt := NewRuntime(Config{Stdout: &strings.Builder{}})
+	if _, err := rt.Run("v: a = 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := rt.Run("a * 21\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.ObValue(); got != "42" {
+		t.Errorf("got %s, want 42", got)
+	}
+	if _, ok := rt.Lookup("a"); !ok {
+		t.Error("a is not bound after the run")
+	}
+	if _, ok := NewRuntime(Config{}).Lookup("a"); ok {
+		t.Error("a is bound in a fresh runtime")
+	}
+}
+
+func TestRuntimesRunConcurrently(t *testing.T) {
+	code := "v: sum = f(n):\n    i(n == 0):\n        r: 0\n    :i\n    r: n + sum(n - 1)\n:f\nprint(sum(n))\n"
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			var out strings.Builder
+			rt := NewRuntime(Config{
+				Stdout:  &out,
+				Globals: map[string]obj.Object{"n": &obj.Integer{Value: int64(n * 100)}},
+			})
+			if _, err := rt.Run(code); err != nil {
+				t.Error(err)
+				return
+			}
+			if got, want := out.String(), fmt.Sprintln(n*100*(n*100+1)/2); got != want {
+				t.Errorf("n = %d : got %q, want %q", n*100, got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRuntimeRegister(t *testing.T) {
+	var out strings.Builder
+	rt := NewRuntime(Config{Stdout: &out})
+	rt.Register("double", func(args ...obj.Object) obj.Object {
+		return &obj.Integer{Value: args[0].(*obj.Integer).Value * 2}
+	})
+	rt.RegisterBuiltIn("shout", &obj.BuiltIn{
+		Bfunct: func(args ...obj.Object) obj.Object {
+			return &obj.String{Value: strings.ToUpper(args[0].(*obj.String).Value)}
+		},
+		Sig: &obj.Signature{Params: []obj.ObjectType{obj.STRING}},
+	})
+	if _, err := rt.Run("print(double(21))\nprint(shout(\"hi\"))\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "42\nHI\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// builtins are per runtime
+	if _, err := NewRuntime(Config{Stdout: &out}).Run("double(1)\n"); err == nil {
+		t.Error("double is callable from another runtime")
+	}
+}
+
+func TestRuntimeSignatures(t *testing.T) {
+	rt := NewRuntime(Config{Stdout: &strings.Builder{}})
+	rt.RegisterBuiltIn("pair", &obj.BuiltIn{
+		Bfunct: func(args ...obj.Object) obj.Object { return evl.EMPTY },
+		Sig:    &obj.Signature{Params: []obj.ObjectType{obj.INTEGER, obj.STRING}},
+	})
+	rt.RegisterBuiltIn("sum", &obj.BuiltIn{
+		Bfunct: func(args ...obj.Object) obj.Object { return evl.EMPTY },
+		Sig:    &obj.Signature{Params: []obj.ObjectType{obj.STRING, obj.INTEGER}, Variadic: true},
+	})
+	rt.Register("fail", func(args ...obj.Object) obj.Object {
+		evl.ReportError("failed on purpose")
+		return evl.EMPTY
+	})
+	tests := []struct {
+		code string
+		msg  string
+	}{
+		{"pair(1, \"a\")\n", ""},
+		{"pair(1)\n", "pair takes 2 argument(s), got 1"},
+		{"pair(\"a\", 1)\n", `argument 1 of pair must be of type "INTEGER", got "STRING"`},
+		{"sum(\"a\")\n", ""},
+		{"sum(\"a\", 1, 2, 3)\n", ""},
+		{"sum()\n", "sum takes at least 1 argument(s), got 0"},
+		{"sum(\"a\", 1, 2.5)\n", `argument 3 of sum must be of type "INTEGER", got "FLOATING"`},
+		{"print(1)\nfail()\n", "failed on purpose"},
+	}
+	for _, tt := range tests {
+		_, err := rt.Run(tt.code)
+		var re *evl.RuntimeError
+		switch {
+		case tt.msg == "" && err != nil:
+			t.Errorf("%q : %v", tt.code, err)
+		case tt.msg != "" && !errors.As(err, &re):
+			t.Errorf("%q : got %v, want a runtime error", tt.code, err)
+		case tt.msg != "" && re.Msg != tt.msg:
+			t.Errorf("%q : got %q, want %q", tt.code, re.Msg, tt.msg)
+		}
+	}
+}
+
+func TestRuntimeHostBooleans(t *testing.T) {
+	var out strings.Builder
+	rt := NewRuntime(Config{Stdout: &out})
+	if err := rt.RegisterFunc("even", func(n int) bool { return n%2 == 0 }); err != nil {
+		t.Fatal(err)
+	}
+	flag, _ := obj.ToObject(true)
+	rt.Define("flag", flag)
+	// a host built Boolean that is not one of the canonical objects
+	rt.Define("other", &obj.Boolean{Value: false})
+	code := "print(even(2) == true)\nprint(even(3) == false)\nprint(flag == true)\nprint(other == false)\nprint(other != flag)\n"
+	if _, err := rt.Run(code); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), strings.Repeat("true\n", 5); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRuntimeErrorLocation(t *testing.T) {
+	rt := NewRuntime(Config{Stdout: &strings.Builder{}})
+	var re *evl.RuntimeError
+	_, err := rt.Run("v: a = 1\nprint(a + nope)\n")
+	if !errors.As(err, &re) {
+		t.Fatalf("got %v, want a runtime error", err)
+	}
+	if re.Line != 2 || re.Column != 11 || re.Source != "print(a + nope)" {
+		t.Errorf("got line %d, column %d, source %q", re.Line, re.Column, re.Source)
+	}
+
+	// an error in a function is shown with the source the function was
+	// defined in, not the source of the run calling it
+	if _, err := rt.Run("v: g = f(x):\n    r: x + missing\n:f\n"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.Run("g(1)\n")
+	if !errors.As(err, &re) {
+		t.Fatalf("got %v, want a runtime error", err)
+	}
+	if re.Line != 2 || re.Source != "    r: x + missing" {
+		t.Errorf("got line %d, source %q", re.Line, re.Source)
+	}
+}
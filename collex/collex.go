@@ -3,17 +3,41 @@ package collex
 import (
 	tok "colon/coltok"
 	"fmt"
-	"os"
 	"strings"
 )
 
+// LexError : an error found while scanning the source. Line and Column are 1-based.
+type LexError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("Error on line %d, column %d : %s", e.Line, e.Column, e.Msg)
+}
+
+// Comment : a "# ... #" comment. Line and Column are 0-based, like those of
+// tokens, and locate the opening "#". Text is what is between the two "#"s.
+type Comment struct {
+	Text   string
+	Line   int
+	Column int
+	Inline bool // whether code comes before the comment on its line
+}
+
 // Lexer : Current state of the lexer
 type Lexer struct {
-	Source  string
-	CurrPos int
-	NextPos int
-	Ch      byte
-	line    int
+	Source    string
+	CurrPos   int
+	NextPos   int
+	Ch        byte
+	line      int
+	lineStart int           // position of the first character of the current line
+	column    int           // column at which the token being scanned starts
+	last      tok.TokenType // type of the last token scanned that did not end a line
+	errors    []*LexError
+	comments  []Comment
 }
 
 // CreateLexerState : to create a new lexer state and initialize it
@@ -22,9 +46,11 @@ func CreateLexerState(source string) *Lexer {
 		Source:  source,
 		CurrPos: 0,
 		NextPos: 1,
-		Ch:      source[0],
 		line:    0,
 	}
+	if len(source) > 0 {
+		l.Ch = source[0]
+	}
 	return &l
 }
 
@@ -51,12 +77,15 @@ func (l *Lexer) PeekChar() byte {
 func (l *Lexer) NextToken() tok.Token {
 	var token tok.Token
 	l.consumeWhiteSpace()
+	l.column = l.CurrPos - l.lineStart
 	switch l.Ch {
 	case '\n':
 		token = tok.NewToken(tok.EOL, "", l.line)
-		l.line++
+		l.newLine()
 	case ',':
 		token = tok.NewToken(tok.COM, string(l.Ch), l.line)
+	case '.':
+		token = tok.NewToken(tok.DOT, string(l.Ch), l.line)
 	case '+':
 		token = tok.NewToken(tok.PLS, string(l.Ch), l.line)
 	case '-':
@@ -77,6 +106,10 @@ func (l *Lexer) NextToken() tok.Token {
 		token = tok.NewToken(tok.LSB, string(l.Ch), l.line)
 	case ']':
 		token = tok.NewToken(tok.RSB, string(l.Ch), l.line)
+	case '{':
+		token = tok.NewToken(tok.LBR, string(l.Ch), l.line)
+	case '}':
+		token = tok.NewToken(tok.RBR, string(l.Ch), l.line)
 	case '=':
 		if l.PeekChar() == '=' {
 			token = tok.NewToken(tok.EQL, "==", l.line)
@@ -130,15 +163,12 @@ func (l *Lexer) NextToken() tok.Token {
 		} else if l.Ch == '#' {
 			token = l.readComment()
 		} else {
-			token = tok.NewToken(tok.ILG, string(l.Ch), l.line)
+			token = l.illegal(string(l.Ch), fmt.Sprintf("ILLEGAL_TOKEN [ %s ] found.", string(l.Ch)))
 		}
 	}
-
-	if token.TokType == tok.ILG {
-		fmt.Println("--------------------------------------------------------------------------------")
-		fmt.Println("Error on line : ", l.line, " ILLEGAL_TOKEN [", token.Literal, "] found.")
-		fmt.Println("--------------------------------------------------------------------------------")
-		os.Exit(65)
+	token.Column = l.column
+	if token.TokType != tok.EOL {
+		l.last = token.TokType
 	}
 	return token
 }
@@ -149,7 +179,7 @@ func (l *Lexer) readNumber() tok.Token {
 	for tok.IsDigit(l.PeekChar()) || l.PeekChar() == '.' {
 		if l.Ch == '.' {
 			if !tok.IsDigit(l.PeekChar()) {
-				return tok.NewToken(tok.ILG, "", l.line)
+				return l.illegal(number, fmt.Sprintf("malformed number %q", number))
 			}
 			floating = true
 		}
@@ -168,6 +198,11 @@ func (l *Lexer) readWord() tok.Token {
 		word = word + string(l.PeekChar())
 		l.ReadChar()
 	}
+	// t and c are only keywords where a try or its catch can start, so that
+	// code using them as names keeps working
+	if (word == "t" && !l.blockFollows()) || (word == "c" && l.last != tok.TRE) {
+		return tok.NewToken(tok.IDN, word, l.line)
+	}
 	if tok.IsKeyword(word) {
 		return tok.NewToken(tok.Keywords[word], word, l.line)
 	} else if word == "true" || word == "false" ||
@@ -179,36 +214,78 @@ func (l *Lexer) readWord() tok.Token {
 	return tok.NewToken(tok.IDN, word, l.line)
 }
 
+// blockFollows : whether the next token is the ':' that opens a block, and
+// not a block closer such as ':i'
+func (l *Lexer) blockFollows() bool {
+	k := l.NextPos
+	for k < len(l.Source) && (l.Source[k] == ' ' || l.Source[k] == '\t') {
+		k++
+	}
+	if k >= len(l.Source) || l.Source[k] != ':' {
+		return false
+	}
+	return k+1 >= len(l.Source) || !tok.IsKeyword(l.Source[k:k+2])
+}
+
 func (l *Lexer) readString() tok.Token {
-	var str string
+	line := l.line
 	l.ReadChar()
+	// the literal is sliced from the source rather than built a byte at a
+	// time, so that multi-byte UTF-8 characters are kept whole
+	start := l.CurrPos
 	for l.Ch != '"' {
+		if l.Ch == 0 {
+			l.errors = append(l.errors, &LexError{Line: line + 1, Column: l.column + 1, Msg: "string literal may not be closed"})
+			return tok.NewToken(tok.ILG, l.Source[start:l.CurrPos], line)
+		}
 		if l.Ch == '\\' && l.PeekChar() == '"' {
-			str = str + string(l.Ch) + string(l.PeekChar())
 			l.ReadChar()
-		} else {
-			str = str + string(l.Ch)
+		} else if l.Ch == '\n' {
+			l.newLine()
 		}
 		l.ReadChar()
-
-		if l.Ch == 0 {
-			fmt.Println("--------------------------------------------------------------------------------")
-			fmt.Printf("Error on line %d, string literal may not be closed\n", l.line)
-			fmt.Println("--------------------------------------------------------------------------------")
-			os.Exit(22)
-		}
 	}
-	return tok.NewToken(tok.STR, str, l.line)
+	return tok.NewToken(tok.STR, l.Source[start:l.CurrPos], line)
 }
 
+// readComment : skips over a comment, recording it for tools that need
+// comments, such as the formatter. To the parser a comment ends a line.
 func (l *Lexer) readComment() tok.Token {
+	line := l.line
+	start := l.CurrPos
+	comment := Comment{
+		Line:   line,
+		Column: l.column,
+		Inline: strings.TrimSpace(l.Source[l.lineStart:start]) != "",
+	}
 	l.ReadChar()
 	for l.Ch != '#' {
+		if l.Ch == 0 {
+			l.errors = append(l.errors, &LexError{Line: line + 1, Column: l.column + 1, Msg: "comment may not be closed"})
+			return tok.NewToken(tok.ILG, "#", line)
+		}
+		if l.Ch == '\n' {
+			l.newLine()
+		}
 		l.ReadChar()
 	}
+	comment.Text = l.Source[start+1 : l.CurrPos]
+	l.comments = append(l.comments, comment)
 	return tok.NewToken(tok.EOL, "", l.line)
 }
 
+// newLine : to move the line bookkeeping past a newline character at the current position
+func (l *Lexer) newLine() {
+	l.line++
+	l.lineStart = l.NextPos
+}
+
+// illegal : records an error at the start of the current token and returns an ILLEGAL token
+func (l *Lexer) illegal(lit, msg string) tok.Token {
+	l.errors = append(l.errors, &LexError{Line: l.line + 1, Column: l.column + 1, Msg: msg})
+	return tok.NewToken(tok.ILG, lit, l.line)
+}
+
 func (l *Lexer) consumeWhiteSpace() {
 	for l.Ch == ' ' || l.Ch == '\t' || l.Ch == '\r' {
 		l.ReadChar()
@@ -223,12 +300,24 @@ func (l *Lexer) Lex() []tok.Token {
 		l.ReadChar()
 	}
 	// pad tokens with an EOF at the end in case the input does not end in EOF
-	if tokens[len(tokens)-1].TokType != tok.EOF {
+	if len(tokens) == 0 {
+		tokens = append(tokens, tok.NewToken(tok.EOF, "", 0))
+	} else if tokens[len(tokens)-1].TokType != tok.EOF {
 		tokens = append(tokens, tok.NewToken(tok.EOF, "", tokens[len(tokens)-1].Line+1))
 	}
 	return tokens
 }
 
+// Errors : returns the errors found while lexing, in the order they were found
+func (l *Lexer) Errors() []*LexError {
+	return l.errors
+}
+
+// Comments : returns the comments found while lexing, in the order they appear
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
 // SourceLines : returns list of lines of text in the source code (For better error handling).
 func (l *Lexer) SourceLines() []string {
 	return strings.Split(l.Source, "\n")
@@ -0,0 +1,97 @@
+package collex
+
+import (
+	tok "colon/coltok"
+	"testing"
+)
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		line int
+		msg  string
+	}{
+		{"v: a = 1 $ 2\n", 1, "ILLEGAL_TOKEN [ $ ] found."},
+		{"print(1)\nprint(@)\n", 2, "ILLEGAL_TOKEN [ @ ] found."},
+		{"v: a = 1..2\n", 1, `malformed number "1."`},
+	}
+	for _, tt := range tests {
+		l := CreateLexerState(tt.code)
+		toks := l.Lex()
+		errs := l.Errors()
+		if len(errs) == 0 {
+			t.Errorf("%q : no errors", tt.code)
+			continue
+		}
+		if errs[0].Line != tt.line || errs[0].Msg != tt.msg {
+			t.Errorf("%q : got line %d %q, want line %d %q", tt.code, errs[0].Line, errs[0].Msg, tt.line, tt.msg)
+		}
+		if last := toks[len(toks)-1]; last.TokType != tok.EOF {
+			t.Errorf("%q : last token is %v, want EOF", tt.code, last.TokType)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	toks := CreateLexerState("v: a = 1\n\tprint(a)\n").Lex()
+	want := []struct {
+		lit          string
+		line, column int
+	}{
+		{"v", 0, 0}, {":", 0, 1}, {"a", 0, 3}, {"=", 0, 5}, {"1", 0, 7},
+		{"print", 1, 1}, {"(", 1, 6}, {"a", 1, 7}, {")", 1, 8},
+	}
+	k := 0
+	for _, tk := range toks {
+		if tk.TokType == tok.EOL || tk.TokType == tok.EOF {
+			continue
+		}
+		if k >= len(want) {
+			t.Fatalf("extra token %q", tk.Literal)
+		}
+		w := want[k]
+		if tk.Literal != w.lit || tk.Line != w.line || tk.Column != w.column {
+			t.Errorf("token %d : got %q at %d:%d, want %q at %d:%d", k, tk.Literal, tk.Line, tk.Column, w.lit, w.line, w.column)
+		}
+		k++
+	}
+}
+
+func TestTryCatchKeywords(t *testing.T) {
+	tests := []struct {
+		code string
+		want []tok.TokenType
+	}{
+		{"t :\n:t c (err) :\n:c\n", []tok.TokenType{tok.TRB, tok.TRE, tok.CTB, tok.CTE}},
+		{"t:\n:t c(err):\n:c\n", []tok.TokenType{tok.TRB, tok.TRE, tok.CTB, tok.CTE}},
+		{"v: t = c\n", []tok.TokenType{tok.VAR, tok.IDN, tok.IDN}},
+		{"print(t, c)\n", []tok.TokenType{tok.IDN, tok.IDN, tok.IDN}},
+		// a c that does not follow :t is a name, even after a try
+		{"t :\n    c\n:t\n", []tok.TokenType{tok.TRB, tok.IDN, tok.TRE}},
+	}
+	for _, tt := range tests {
+		got := []tok.TokenType{}
+		for _, tk := range CreateLexerState(tt.code).Lex() {
+			if tk.Literal == "t" || tk.Literal == "c" || tk.Literal == ":t" || tk.Literal == ":c" || tk.TokType == tok.VAR || tk.Literal == "print" {
+				got = append(got, tk.TokType)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q : got %v, want %v", tt.code, got, tt.want)
+			continue
+		}
+		for k := range got {
+			if got[k] != tt.want[k] {
+				t.Errorf("%q : got %v, want %v", tt.code, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestStringKeepsUTF8(t *testing.T) {
+	l := CreateLexerState("\"héllo, 世界\"")
+	if token := l.NextToken(); token.Literal != "héllo, 世界" {
+		t.Errorf("got %q, want %q", token.Literal, "héllo, 世界")
+	}
+}
@@ -0,0 +1,417 @@
+package collsp
+
+import (
+	"bufio"
+	ast "colon/colast"
+	chk "colon/colcheck"
+	evl "colon/coleval"
+	"colon/colinterp"
+	lex "colon/collex"
+	par "colon/colparc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime/debug"
+	"strings"
+	"unicode/utf8"
+)
+
+// Server : a language server for colon, speaking the Language Server
+// Protocol over a pair of streams. It keeps the text of the documents the
+// client has open and reports the errors the lexer, the parser and the
+// checker find in them as diagnostics.
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	ev        *evl.Evaluator // whose builtins are completed and known to the checker
+	documents map[string]*document
+	shutdown  bool
+}
+
+// document : an open document. program and checker are nil while the text
+// does not parse.
+type document struct {
+	lines   []string
+	program *ast.Program
+	checker *chk.Checker
+}
+
+// NewServer : creates a server reading messages from in and writing them to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		ev:        evl.NewEvaluator(strings.NewReader(""), ioutil.Discard),
+		documents: map[string]*document{},
+	}
+}
+
+// Serve : handles messages until the client sends exit. It returns an error
+// if the client exits without asking the server to shut down first, or if
+// the input ends or cannot be read.
+func (s *Server) Serve() error {
+	for {
+		body, err := readMessage(s.in)
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &responseError{Code: parseError, Message: err.Error()})
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(msg.Method, msg.Params)
+		if msg.ID != nil {
+			s.reply(msg.ID, result, rerr)
+		}
+	}
+}
+
+// reply : sends the response to a request
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+	res := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			res.Error = &responseError{Code: parseError, Message: err.Error()}
+		} else {
+			raw := json.RawMessage(encoded)
+			res.Result = &raw
+		}
+	}
+	writeMessage(s.out, res)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// logPanic : sends the client the value of a panic and the stack it was
+// raised on, for its log
+func (s *Server) logPanic(method string, r interface{}) {
+	s.notify("window/logMessage", logMessageParams{
+		Type:    messageError,
+		Message: fmt.Sprintf("panic while handling %s: %v\n%s", method, r, debug.Stack()),
+	})
+}
+
+// handle : handles a request or notification, returning the result of a
+// request. Notifications the server does not know are ignored. A panic
+// while handling one message is logged and returned as an internal error
+// rather than ending the server.
+func (s *Server) handle(method string, params json.RawMessage) (result interface{}, rerr *responseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logPanic(method, r)
+			result, rerr = nil, &responseError{Code: internalError, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+	decode := func(v interface{}) *responseError {
+		if err := json.Unmarshal(params, v); err != nil {
+			return &responseError{Code: invalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+	switch method {
+	case "initialize":
+		return s.initialize(), nil
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		// changes are whole documents, as asked for in initialize
+		if n := len(p.ContentChanges); n > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		delete(s.documents, p.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.definition(p), nil
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.hover(p), nil
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(p.TextDocument.URI), nil
+	case "textDocument/completion":
+		return s.completion(), nil
+	default:
+		return nil, &responseError{Code: methodNotFound, Message: fmt.Sprintf("method %q not supported", method)}
+	}
+	return nil, nil
+}
+
+func (s *Server) initialize() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":       1, // the whole document is sent on every change
+			"definitionProvider":     true,
+			"hoverProvider":          true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]interface{}{},
+		},
+		"serverInfo": map[string]string{"name": "colon"},
+	}
+}
+
+// update : parses and checks the new text of a document and publishes the
+// problems found in it
+func (s *Server) update(uri string, text string) {
+	doc := &document{lines: strings.Split(text, "\n")}
+	s.documents[uri] = doc
+	diagnostics := []diagnostic{}
+	// a document the lexer, the parser or the checker fails on is reported
+	// as having an error, and is otherwise treated as not parsing
+	defer func() {
+		if r := recover(); r != nil {
+			s.logPanic("document "+uri, r)
+			doc.program, doc.checker = nil, nil
+			diagnostics := []diagnostic{doc.diagnostic(0, 0, severityError, fmt.Sprintf("internal error: %v", r))}
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+		}
+	}()
+
+	program, err := colinterp.Parse(text)
+	if el, ok := err.(colinterp.ErrorList); ok {
+		for _, e := range el {
+			switch e := e.(type) {
+			case *lex.LexError:
+				diagnostics = append(diagnostics, doc.diagnostic(e.Line-1, e.Column-1, severityError, e.Msg))
+			case *par.ParseError:
+				diagnostics = append(diagnostics, doc.diagnostic(e.Line-1, e.Column-1, severityError, e.Msg))
+			}
+		}
+	} else if err == nil {
+		doc.program = program
+		doc.checker = chk.NewChecker(s.ev, nil)
+		for _, d := range doc.checker.Check(program) {
+			severity := severityWarning
+			if d.Severity == chk.ERROR {
+				severity = severityError
+			}
+			diagnostics = append(diagnostics, doc.diagnostic(d.Line-1, d.Column-1, severity, d.Msg))
+		}
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// diagnostic : a diagnostic for the token at a 0-based line and column
+func (doc *document) diagnostic(line, column int, severity int, msg string) diagnostic {
+	start := doc.position(line, column)
+	end := start
+	end.Character++
+	return diagnostic{Range: lspRange{start, end}, Severity: severity, Source: "colon", Message: msg}
+}
+
+// position : the LSP position of a 0-based line and byte column
+func (doc *document) position(line, column int) position {
+	if line < 0 {
+		line = 0
+	}
+	if column < 0 {
+		column = 0
+	}
+	character := column
+	if line < len(doc.lines) {
+		text := doc.lines[line]
+		if column > len(text) {
+			column = len(text)
+		}
+		character = utf16Length(text[:column])
+	}
+	return position{Line: line, Character: character}
+}
+
+// column : the byte column of an LSP position
+func (doc *document) column(pos position) int {
+	if pos.Line < 0 || pos.Line >= len(doc.lines) {
+		return pos.Character
+	}
+	text := doc.lines[pos.Line]
+	units := 0
+	for k, r := range text {
+		if units >= pos.Character {
+			return k
+		}
+		units += utf16Length(string(r))
+	}
+	return len(text)
+}
+
+func utf16Length(s string) int {
+	units := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+	}
+	return units
+}
+
+// identifierRange : the range an identifier takes up
+func (doc *document) identifierRange(ident *ast.Identifier) lspRange {
+	pos := ident.Pos()
+	return lspRange{
+		Start: doc.position(pos.Line, pos.Column),
+		End:   doc.position(pos.Line, pos.Column+len(ident.Value)),
+	}
+}
+
+// identifierAt : the identifier at a position in a document, or nil
+func (s *Server) identifierAt(uri string, pos position) (*document, *ast.Identifier) {
+	doc, ok := s.documents[uri]
+	if !ok || doc.program == nil {
+		return nil, nil
+	}
+	column := doc.column(pos)
+	var found *ast.Identifier
+	ast.Inspect(doc.program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			p := ident.Pos()
+			if p.Line == pos.Line && p.Column <= column && column <= p.Column+utf8.RuneCountInString(ident.Value) {
+				found = ident
+			}
+		}
+		return found == nil
+	})
+	return doc, found
+}
+
+// definition : the location of the declaration of the name at a position
+func (s *Server) definition(p textDocumentPositionParams) interface{} {
+	doc, ident := s.identifierAt(p.TextDocument.URI, p.Position)
+	if ident == nil {
+		return nil
+	}
+	decl := doc.checker.Definition(ident)
+	if decl == nil {
+		return nil
+	}
+	return location{URI: p.TextDocument.URI, Range: doc.identifierRange(decl)}
+}
+
+// hover : what is known about the name at a position: the parameters of a
+// function, where a variable is declared, or what a builtin takes
+func (s *Server) hover(p textDocumentPositionParams) interface{} {
+	doc, ident := s.identifierAt(p.TextDocument.URI, p.Position)
+	if ident == nil {
+		return nil
+	}
+	var text string
+	if fe := doc.checker.FunctionOf(ident); fe != nil {
+		text = fmt.Sprintf("%s\n\nfunction declared on line %d", signature(ident.Value, fe), doc.checker.Definition(ident).Pos().Line+1)
+	} else if decl := doc.checker.Definition(ident); decl != nil {
+		text = fmt.Sprintf("%s\n\nvariable declared on line %d", ident.Value, decl.Pos().Line+1)
+	} else if bin, ok := s.ev.BuiltIn(ident.Value); ok {
+		text = ident.Value + "\n\nbuiltin"
+		if bin.Sig != nil {
+			count := len(bin.Sig.Params)
+			if bin.Sig.Variadic {
+				text += fmt.Sprintf(", takes at least %d argument(s)", count-1)
+			} else {
+				text += fmt.Sprintf(", takes %d argument(s)", count)
+			}
+		}
+	} else {
+		return nil
+	}
+	return hover{
+		Contents: markupContent{Kind: "plaintext", Value: text},
+		Range:    doc.identifierRange(ident),
+	}
+}
+
+// signature : how a function bound to name is called
+func signature(name string, fe *ast.FunctionExpression) string {
+	params := []string{}
+	for _, param := range fe.Params {
+		params = append(params, param.Value)
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// documentSymbols : the functions declared at the top level of a document
+func (s *Server) documentSymbols(uri string) interface{} {
+	symbols := []documentSymbol{}
+	doc, ok := s.documents[uri]
+	if !ok || doc.program == nil {
+		return symbols
+	}
+	for _, stmt := range doc.program.Statements {
+		vs, ok := stmt.(*ast.VarStatement)
+		if !ok {
+			continue
+		}
+		fe, ok := vs.Value.(*ast.FunctionExpression)
+		if !ok {
+			continue
+		}
+		// the function ends with the ":f" on the line after its last statement
+		last := vs.Pos().Line
+		ast.Inspect(fe, func(node ast.Node) bool {
+			if line := node.Pos().Line; line > last {
+				last = line
+			}
+			return true
+		})
+		if last+1 < len(doc.lines) {
+			last++
+		}
+		start := vs.Pos()
+		symbols = append(symbols, documentSymbol{
+			Name:   vs.Name.Value,
+			Detail: signature(vs.Name.Value, fe),
+			Kind:   symbolFunction,
+			Range: lspRange{
+				Start: doc.position(start.Line, start.Column),
+				End:   doc.position(last, len(doc.lines[last])),
+			},
+			SelectionRange: doc.identifierRange(vs.Name),
+		})
+	}
+	return symbols
+}
+
+// completion : the builtins, which can be used anywhere
+func (s *Server) completion() interface{} {
+	items := []completionItem{}
+	for _, name := range s.ev.BuiltinNames() {
+		items = append(items, completionItem{Label: name, Kind: completionFunction, Detail: "builtin"})
+	}
+	return items
+}
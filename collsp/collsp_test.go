@@ -0,0 +1,145 @@
+package collsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// session : runs a server over the given messages, which must end with
+// exit, and returns the messages it sent back
+func session(t *testing.T, messages ...interface{}) []message {
+	var in, out bytes.Buffer
+	for _, msg := range messages {
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatalf("Serve : %v", err)
+	}
+	sent := []message{}
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			return sent
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg struct {
+			message
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method == "" {
+			msg.Params = msg.Result
+		}
+		sent = append(sent, msg.message)
+	}
+}
+
+func request(id int, method string, params interface{}) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notice(method string, params interface{}) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func open(uri string, text string) interface{} {
+	return notice("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri, LanguageID: "colon", Text: text}})
+}
+
+func TestServe(t *testing.T) {
+	sent := session(t,
+		request(1, "initialize", map[string]interface{}{}),
+		notice("initialized", map[string]interface{}{}),
+		open("file:///bad.col", "print("),
+		open("file:///good.col", "v: x = 1\nv: g = f(x):\n    r: x\n:f\nprint(g(x))\n"),
+		request(2, "textDocument/hover", textDocumentPositionParams{
+			TextDocument: textDocumentIdentifier{URI: "file:///bad.col"},
+		}),
+		request(3, "shutdown", nil),
+		notice("exit", nil),
+	)
+	if len(sent) != 5 {
+		t.Fatalf("sent %d messages, want 5 : %v", len(sent), sent)
+	}
+
+	if !strings.Contains(string(sent[0].Params), `"definitionProvider":true`) {
+		t.Errorf("initialize returned %s", sent[0].Params)
+	}
+
+	diagnosticsOf := func(msg message, uri string) []diagnostic {
+		var p publishDiagnosticsParams
+		if msg.Method != "textDocument/publishDiagnostics" {
+			t.Fatalf("sent %q, want diagnostics for %s", msg.Method, uri)
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.URI != uri {
+			t.Fatalf("sent diagnostics for %s, want %s", p.URI, uri)
+		}
+		return p.Diagnostics
+	}
+	bad := diagnosticsOf(sent[1], "file:///bad.col")
+	if len(bad) == 0 || bad[0].Severity != severityError {
+		t.Errorf("diagnostics for an unclosed call : %+v", bad)
+	}
+	good := diagnosticsOf(sent[2], "file:///good.col")
+	if len(good) != 1 || good[0].Severity != severityWarning || good[0].Range.Start != (position{Line: 1, Character: 9}) {
+		t.Errorf("diagnostics for a shadowed name : %+v", good)
+	}
+
+	// the server is still answering after the document it could not parse
+	if string(sent[3].Params) != "null" || string(sent[4].Params) != "null" {
+		t.Errorf("hover and shutdown returned %s and %s", sent[3].Params, sent[4].Params)
+	}
+}
+
+func TestReadMessageCapsLength(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("Content-Length: 1000000000\r\n\r\n{}"))
+	if _, err := readMessage(r); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("got %v, want an error for a length above the cap", err)
+	}
+	r = bufio.NewReader(strings.NewReader("Content-Length: 2\r\n\r\n{}"))
+	if body, err := readMessage(r); err != nil || string(body) != "{}" {
+		t.Errorf("got %q, %v, want {}", body, err)
+	}
+}
+
+func TestHandleRecovers(t *testing.T) {
+	var out bytes.Buffer
+	s := NewServer(strings.NewReader(""), &out)
+	// without its documents the server panics on the first one opened
+	s.documents = nil
+	params, _ := json.Marshal(didOpenParams{TextDocument: textDocumentItem{URI: "file:///a.col", Text: "print(1)"}})
+	_, rerr := s.handle("textDocument/didOpen", params)
+	if rerr == nil || rerr.Code != internalError {
+		t.Fatalf("got %+v, want an internal error", rerr)
+	}
+	body, err := readMessage(bufio.NewReader(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg message
+	var p logMessageParams
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "window/logMessage" || p.Type != messageError ||
+		!strings.Contains(p.Message, "panic while handling textDocument/didOpen") || !strings.Contains(p.Message, "goroutine") {
+		t.Errorf("logged %s %+v, want the panic and its stack", msg.Method, p)
+	}
+}
@@ -0,0 +1,420 @@
+package colobj
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Conversions between Go values and colon objects, for code embedding colon.
+// Go maps and structs both convert to colon maps; the keys of a map are
+// inserted in sorted order, the fields of a struct in declaration order.
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject : converts a Go value into the equivalent colon object. Nil
+// converts to Empty, and funcs are wrapped as builtins with WrapFunc.
+func ToObject(v interface{}) (Object, error) {
+	if v == nil {
+		return EmptyObject, nil
+	}
+	if o, ok := v.(Object); ok {
+		return o, nil
+	}
+	return valueToObject(reflect.ValueOf(v))
+}
+
+func valueToObject(v reflect.Value) (Object, error) {
+	if v.IsValid() && v.Type().Implements(objectType) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		return v.Interface().(Object), nil
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return EmptyObject, nil
+	case reflect.Bool:
+		return BooleanObject(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d overflows a colon integer", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Floating{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return EmptyObject, nil
+		}
+		return valueToObject(v.Elem())
+	case reflect.Slice, reflect.Array:
+		list := &List{Elements: []Object{}}
+		for k := 0; k < v.Len(); k++ {
+			elem, err := valueToObject(v.Index(k))
+			if err != nil {
+				return nil, err
+			}
+			list.Elements = append(list.Elements, elem)
+		}
+		return list, nil
+	case reflect.Map:
+		keys := v.MapKeys()
+		objKeys := make([]Hashable, len(keys))
+		for k, key := range keys {
+			objKey, err := valueToObject(key)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := objKey.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("map key of type %s cannot be used as a colon map key", key.Type())
+			}
+			objKeys[k] = hashable
+		}
+		order := make([]int, len(keys))
+		for k := range order {
+			order[k] = k
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return objKeys[order[i]].ObValue() < objKeys[order[j]].ObValue()
+		})
+		m := NewMap()
+		for _, k := range order {
+			val, err := valueToObject(v.MapIndex(keys[k]))
+			if err != nil {
+				return nil, err
+			}
+			m.Set(objKeys[k], val)
+		}
+		return m, nil
+	case reflect.Struct:
+		m := NewMap()
+		for k := 0; k < v.NumField(); k++ {
+			if v.Type().Field(k).PkgPath != "" {
+				continue // unexported
+			}
+			val, err := valueToObject(v.Field(k))
+			if err != nil {
+				return nil, err
+			}
+			m.Set(&String{Value: v.Type().Field(k).Name}, val)
+		}
+		return m, nil
+	case reflect.Func:
+		return WrapFunc(v.Interface())
+	}
+	return nil, fmt.Errorf("cannot convert value of type %s to a colon object", v.Type())
+}
+
+// FromObject : converts a colon object into a plain Go value: int64, float64,
+// string, bool, []interface{} for lists, map[interface{}]interface{} for maps,
+// or nil for Empty. Lists and maps that hold themselves cannot be converted.
+func FromObject(o Object) (interface{}, error) {
+	return fromObject(o, map[Object]bool{})
+}
+
+// fromObject : FromObject, with the lists and maps being converted further
+// up kept in path
+func fromObject(o Object, path map[Object]bool) (interface{}, error) {
+	switch o := o.(type) {
+	case *Integer:
+		return o.Value, nil
+	case *Floating:
+		return o.Value, nil
+	case *String:
+		return o.Value, nil
+	case *Boolean:
+		return o.Value, nil
+	case *Empty:
+		return nil, nil
+	case *List:
+		leave, err := visit(o, path)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		elems := []interface{}{}
+		for _, v := range o.Elements {
+			elem, err := fromObject(v, path)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	case *Map:
+		leave, err := visit(o, path)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		m := map[interface{}]interface{}{}
+		for _, pair := range o.Entries() {
+			key, err := fromObject(pair.Key, path)
+			if err != nil {
+				return nil, err
+			}
+			val, err := fromObject(pair.Value, path)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("cannot convert colon object of type %q to a Go value", o.ObType())
+}
+
+// visit : marks a list or map as being converted, failing if it already is,
+// which only happens when it holds itself. The returned func unmarks it.
+func visit(o Object, path map[Object]bool) (func(), error) {
+	if path[o] {
+		return nil, fmt.Errorf("cannot convert colon object of type %q that holds itself", o.ObType())
+	}
+	path[o] = true
+	return func() { delete(path, o) }, nil
+}
+
+// Assign : converts a colon object and stores it in the Go value that target
+// points to, e.g. an *int, a *[]string, or a pointer to a struct
+func Assign(o Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot assign to non-pointer or nil target of type %T", target)
+	}
+	return assignValue(o, v.Elem(), map[Object]bool{})
+}
+
+// assignValue : Assign, with the lists and maps being converted further up
+// kept in path
+func assignValue(o Object, v reflect.Value, path map[Object]bool) error {
+	if v.Kind() != reflect.Interface || v.NumMethod() != 0 {
+		if reflect.TypeOf(o).AssignableTo(v.Type()) {
+			v.Set(reflect.ValueOf(o))
+			return nil
+		}
+	}
+	mismatch := fmt.Errorf("cannot assign colon object of type %q to Go value of type %s", o.ObType(), v.Type())
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch
+		}
+		val, err := fromObject(o, path)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(val))
+		}
+		return nil
+	case reflect.Ptr:
+		if _, ok := o.(*Empty); ok {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := assignValue(o, elem.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Bool:
+		if b, ok := o.(*Boolean); ok {
+			v.SetBool(b.Value)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := o.(*Integer); ok {
+			if v.OverflowInt(i.Value) {
+				return fmt.Errorf("integer %d overflows Go value of type %s", i.Value, v.Type())
+			}
+			v.SetInt(i.Value)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := o.(*Integer); ok {
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return fmt.Errorf("integer %d overflows Go value of type %s", i.Value, v.Type())
+			}
+			v.SetUint(uint64(i.Value))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := o.(type) {
+		case *Floating:
+			v.SetFloat(n.Value)
+			return nil
+		case *Integer:
+			v.SetFloat(float64(n.Value))
+			return nil
+		}
+	case reflect.String:
+		if s, ok := o.(*String); ok {
+			v.SetString(s.Value)
+			return nil
+		}
+	case reflect.Slice:
+		if l, ok := o.(*List); ok {
+			leave, err := visit(l, path)
+			if err != nil {
+				return err
+			}
+			defer leave()
+			slice := reflect.MakeSlice(v.Type(), len(l.Elements), len(l.Elements))
+			for k, elem := range l.Elements {
+				if err := assignValue(elem, slice.Index(k), path); err != nil {
+					return err
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+	case reflect.Array:
+		if l, ok := o.(*List); ok {
+			if len(l.Elements) != v.Len() {
+				return fmt.Errorf("cannot assign list of %d elements to Go array of type %s", len(l.Elements), v.Type())
+			}
+			leave, err := visit(l, path)
+			if err != nil {
+				return err
+			}
+			defer leave()
+			for k, elem := range l.Elements {
+				if err := assignValue(elem, v.Index(k), path); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if src, ok := o.(*Map); ok {
+			leave, err := visit(src, path)
+			if err != nil {
+				return err
+			}
+			defer leave()
+			m := reflect.MakeMap(v.Type())
+			for _, pair := range src.Entries() {
+				goKey := reflect.New(v.Type().Key()).Elem()
+				if err := assignValue(pair.Key, goKey, path); err != nil {
+					return err
+				}
+				goVal := reflect.New(v.Type().Elem()).Elem()
+				if err := assignValue(pair.Value, goVal, path); err != nil {
+					return err
+				}
+				m.SetMapIndex(goKey, goVal)
+			}
+			v.Set(m)
+			return nil
+		}
+	case reflect.Struct:
+		if src, ok := o.(*Map); ok {
+			leave, err := visit(src, path)
+			if err != nil {
+				return err
+			}
+			defer leave()
+			for _, pair := range src.Entries() {
+				name, ok := pair.Key.(*String)
+				if !ok {
+					return fmt.Errorf("struct field names must be strings, got %q", pair.Key.ObType())
+				}
+				field := v.FieldByName(name.Value)
+				if !field.IsValid() || !field.CanSet() {
+					return fmt.Errorf("Go type %s has no exported field %q", v.Type(), name.Value)
+				}
+				if err := assignValue(pair.Value, field, path); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return mismatch
+}
+
+// WrapFunc : wraps a Go func as a builtin. Arguments are converted with
+// Assign and results with ToObject. A func may return nothing, a value,
+// an error, or a value and an error; a non-nil error, like a failed
+// conversion, aborts the call with a runtime error.
+func WrapFunc(fn interface{}) (*BuiltIn, error) {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot wrap value of type %s as a builtin", ft)
+	}
+	if ft.NumOut() > 2 || (ft.NumOut() == 2 && ft.Out(1) != errorType) {
+		return nil, fmt.Errorf("cannot wrap func of type %s: it must return at most a value and an error", ft)
+	}
+	sig := &Signature{Variadic: ft.IsVariadic()}
+	for k := 0; k < ft.NumIn(); k++ {
+		in := ft.In(k)
+		if ft.IsVariadic() && k == ft.NumIn()-1 {
+			in = in.Elem()
+		}
+		sig.Params = append(sig.Params, typeOfParam(in))
+	}
+	return &BuiltIn{
+		Bfunct: func(args ...Object) Object {
+			in := make([]reflect.Value, len(args))
+			for k, arg := range args {
+				var pt reflect.Type
+				if ft.IsVariadic() && k >= ft.NumIn()-1 {
+					pt = ft.In(ft.NumIn() - 1).Elem()
+				} else {
+					pt = ft.In(k)
+				}
+				param := reflect.New(pt).Elem()
+				if err := assignValue(arg, param, map[Object]bool{}); err != nil {
+					panic(fmt.Errorf("argument %d: %v", k+1, err))
+				}
+				in[k] = param
+			}
+			out := fv.Call(in)
+			if len(out) > 0 && ft.Out(len(out)-1) == errorType {
+				if err, _ := out[len(out)-1].Interface().(error); err != nil {
+					panic(err)
+				}
+				out = out[:len(out)-1]
+			}
+			if len(out) == 0 {
+				return EmptyObject
+			}
+			result, err := valueToObject(out[0])
+			if err != nil {
+				panic(err)
+			}
+			return result
+		},
+		Sig: sig,
+	}, nil
+}
+
+// typeOfParam : the object type a Go parameter type is checked against, or
+// "" when more than one object type converts to it
+func typeOfParam(t reflect.Type) ObjectType {
+	switch t.Kind() {
+	case reflect.Bool:
+		return BOOLEAN
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return INTEGER
+	case reflect.String:
+		return STRING
+	case reflect.Slice, reflect.Array:
+		return LIST
+	case reflect.Map, reflect.Struct:
+		return MAP
+	}
+	return ""
+}
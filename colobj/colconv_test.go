@@ -0,0 +1,178 @@
+package colobj
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToObject(t *testing.T) {
+	type point struct {
+		X, Y int
+		tag  string
+	}
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, ""},
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{"hi", "hi"},
+		{true, "true"},
+		{[]int{1, 2}, "[1, 2]"},
+		{map[string]int{"b": 2, "a": 1}, "{a = 1, b = 2}"},
+		{point{X: 1, Y: 2, tag: "hidden"}, "{X = 1, Y = 2}"},
+	}
+	for _, tt := range tests {
+		o, err := ToObject(tt.in)
+		if err != nil {
+			t.Errorf("%#v : %v", tt.in, err)
+			continue
+		}
+		if got := o.ObValue(); got != tt.want {
+			t.Errorf("%#v : got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := ToObject(uint64(1 << 63)); err == nil {
+		t.Error("uint64 overflow : no error")
+	}
+	if _, err := ToObject(make(chan int)); err == nil {
+		t.Error("chan : no error")
+	}
+}
+
+func TestToObjectReturnsCanonicalObjects(t *testing.T) {
+	for _, in := range []interface{}{true, false, nil, (*int)(nil)} {
+		o, err := ToObject(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch o {
+		case TrueObject, FalseObject, EmptyObject:
+		default:
+			t.Errorf("%#v : got a new %T", in, o)
+		}
+	}
+	if o, _ := ToObject(true); o != TrueObject {
+		t.Error("true is not TrueObject")
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	list := &List{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}, TrueObject, EmptyObject}}
+	got, err := FromObject(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(1), "a", true, nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestFromObjectMap(t *testing.T) {
+	m, err := ToObject(map[string]int{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromObject(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[interface{}]interface{}{"a": int64(1), "b": int64(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	var n int8
+	if err := Assign(&Integer{Value: 12}, &n); err != nil || n != 12 {
+		t.Errorf("int8 : got %d, %v", n, err)
+	}
+	if err := Assign(&Integer{Value: 300}, &n); err == nil {
+		t.Error("int8 overflow : no error")
+	}
+	var u uint
+	if err := Assign(&Integer{Value: -1}, &u); err == nil {
+		t.Error("negative uint : no error")
+	}
+	var f float64
+	if err := Assign(&Integer{Value: 3}, &f); err != nil || f != 3 {
+		t.Errorf("float from integer : got %v, %v", f, err)
+	}
+	var xs []string
+	if err := Assign(&List{Elements: []Object{&String{Value: "a"}, &String{Value: "b"}}}, &xs); err != nil || !reflect.DeepEqual(xs, []string{"a", "b"}) {
+		t.Errorf("[]string : got %v, %v", xs, err)
+	}
+	var s string
+	if err := Assign(&Integer{Value: 1}, &s); err == nil {
+		t.Error("string from integer : no error")
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	bin, err := WrapFunc(func(s string, n int) string { return strings.Repeat(s, n) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bin.Bfunct(&String{Value: "ab"}, &Integer{Value: 3}).ObValue(); got != "ababab" {
+		t.Errorf("got %s, want ababab", got)
+	}
+	if !reflect.DeepEqual(bin.Sig.Params, []ObjectType{STRING, INTEGER}) {
+		t.Errorf("signature : got %v", bin.Sig.Params)
+	}
+
+	bin, err = WrapFunc(func() (bool, error) { return false, errors.New("nope") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("returned error did not panic")
+		}
+	}()
+	bin.Bfunct()
+}
+
+func TestConvertSelfReferencingContainers(t *testing.T) {
+	list := &List{Elements: []Object{&Integer{Value: 1}, nil}}
+	list.Elements[1] = list
+	m := NewMap()
+	m.Set(&String{Value: "self"}, m)
+
+	if got := list.ObValue(); got != "[1, [...]]" {
+		t.Errorf("list : got %s", got)
+	}
+	if got := m.ObValue(); got != "{self = {...}}" {
+		t.Errorf("map : got %s", got)
+	}
+	for _, o := range []Object{list, m} {
+		if _, err := FromObject(o); err == nil {
+			t.Errorf("FromObject(%s) : no error", o.ObValue())
+		}
+		var any interface{}
+		if err := Assign(o, &any); err == nil {
+			t.Errorf("Assign(%s) to interface{} : no error", o.ObValue())
+		}
+	}
+	type tree []tree
+	var tr tree
+	if err := Assign(list, &tr); err == nil {
+		t.Error("Assign to a recursive Go type : no error")
+	}
+
+	// a list held twice, but not inside itself, converts
+	inner := &List{Elements: []Object{&Integer{Value: 1}}}
+	got, err := FromObject(&List{Elements: []Object{inner, inner}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{[]interface{}{int64(1)}, []interface{}{int64(1)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
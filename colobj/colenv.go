@@ -1,5 +1,7 @@
 package colobj
 
+import "sort"
+
 // Env : container for variables' and functions' bindings
 type Env struct {
 	bindings    map[string]Object
@@ -42,6 +44,30 @@ func (e *Env) Set(name string, val Object) Object {
 	return val
 }
 
+// Assign : to rebind a name in the nearest environment it is bound in,
+// walking out through the environments this one is contained in. Returns
+// false, binding nothing, if the name is not bound anywhere.
+func (e *Env) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.ContainedIn {
+		if _, ok := env.bindings[name]; ok {
+			env.bindings[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// Names : returns the names bound directly in this environment, sorted.
+// Bindings in the environments it is contained in are not included.
+func (e *Env) Names() []string {
+	names := []string{}
+	for name := range e.bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // IsInside : To find out if the current environment is embedded in another
 // environment, which happens when evaluation goes inside of functions or
 // loops
@@ -19,12 +19,16 @@ const (
 	FLOATING = "FLOATING"
 	STRING   = "STRING"
 	LIST     = "LIST"
+	MAP      = "MAP"
 	EMPTY    = "EMPTY"
 	RETVAL   = "RETURN_VALUE"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	ERROR    = "ERROR"
 	FUNCTION = "FUNCTION"
 	LOOP     = "LOOP"
 	BUILTIN  = "BUILT_IN"
-	INPUT    = "INPUT"
+	MODULE   = "MODULE"
 )
 
 // Object : an interface that wraps values of all types which can be fed into the evaluator
@@ -50,6 +54,11 @@ func (i *Integer) ObType() ObjectType {
 	return INTEGER
 }
 
+// MapKey : Integer
+func (i *Integer) MapKey() MapKey {
+	return MapKey{Type: INTEGER, Value: i.ObValue()}
+}
+
 // ----------------------------------------------------------------------------
 
 // Boolean : A wrapper for boolean values
@@ -67,6 +76,27 @@ func (b *Boolean) ObType() ObjectType {
 	return BOOLEAN
 }
 
+// MapKey : Boolean
+func (b *Boolean) MapKey() MapKey {
+	return MapKey{Type: BOOLEAN, Value: b.ObValue()}
+}
+
+// TrueObject, FalseObject : the Boolean objects the evaluator hands out.
+// Conversions from Go return them too, so host booleans and colon booleans
+// are the same objects.
+var (
+	TrueObject  = &Boolean{Value: true}
+	FalseObject = &Boolean{Value: false}
+)
+
+// BooleanObject : returns TrueObject or FalseObject
+func BooleanObject(b bool) *Boolean {
+	if b {
+		return TrueObject
+	}
+	return FalseObject
+}
+
 // ----------------------------------------------------------------------------
 
 // Floating : A wrapper for floating-point values
@@ -101,6 +131,48 @@ func (s *String) ObType() ObjectType {
 	return STRING
 }
 
+// MapKey : String
+func (s *String) MapKey() MapKey {
+	return MapKey{Type: STRING, Value: s.Value}
+}
+
+// ----------------------------------------------------------------------------
+
+// Frame : a call to a colon function. Line is the 1-based line of the call
+// and Args a short description of the arguments it was given.
+type Frame struct {
+	Function string
+	Line     int
+	Args     string
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s(%s) called on line %d", f.Function, f.Args, f.Line)
+}
+
+// Error : a runtime error as a value, as bound by a catch or made by the
+// error builtin. Line and Column are 1-based, and 0 until the error is thrown.
+type Error struct {
+	Message string
+	Line    int
+	Column  int
+	Source  string  // the text of the line the error was thrown on
+	Trace   []Frame // the calls being evaluated when it was thrown, innermost first
+}
+
+// ObValue : Error
+func (e *Error) ObValue() string {
+	if e.Line == 0 {
+		return "error : " + e.Message
+	}
+	return fmt.Sprintf("error on line %d, column %d : %s", e.Line, e.Column, e.Message)
+}
+
+// ObType : Error
+func (e *Error) ObType() ObjectType {
+	return ERROR
+}
+
 // ----------------------------------------------------------------------------
 
 // Empty : Colon's version of Null/Nil.
@@ -116,6 +188,9 @@ func (e *Empty) ObType() ObjectType {
 	return EMPTY
 }
 
+// EmptyObject : the Empty object the evaluator hands out
+var EmptyObject = &Empty{}
+
 // ----------------------------------------------------------------------------
 
 // ReturnValue : structure that wraps the return value into an object so that
@@ -136,11 +211,45 @@ func (r *ReturnValue) ObType() ObjectType {
 
 // ----------------------------------------------------------------------------
 
+// Break : signals that the innermost loop should end. Like ReturnValue,
+// it is passed up through the blocks around it until it reaches the loop.
+type Break struct{}
+
+// ObValue : Break
+func (b *Break) ObValue() string {
+	return "break"
+}
+
+// ObType : Break
+func (b *Break) ObType() ObjectType {
+	return BREAK
+}
+
+// ----------------------------------------------------------------------------
+
+// Continue : signals that the innermost loop should skip to its next iteration
+type Continue struct{}
+
+// ObValue : Continue
+func (c *Continue) ObValue() string {
+	return "continue"
+}
+
+// ObType : Continue
+func (c *Continue) ObType() ObjectType {
+	return CONTINUE
+}
+
+// ----------------------------------------------------------------------------
+
 // Function : structure that wraps function definitions
 type Function struct {
+	Name       string // the name the function was first bound to, if any
 	Parameters []*ast.Identifier
 	FuncBody   *ast.Block
-	Env        *Env // functions have their own environment
+	Env        *Env     // functions have their own environment
+	Module     *Module  // the module the function was defined in, nil for the program being run
+	Lines      []string // the source the function was defined in, for error messages
 }
 
 // ObValue : Function
@@ -193,12 +302,35 @@ func (l *Loop) ObType() ObjectType {
 // into the colon interpreter
 type BuiltInFunction func(args ...Object) Object
 
+// CallingFunction : a builtin that calls the functions it is given, such as
+// map or sort, through the interpreter running it
+type CallingFunction func(caller Caller, args ...Object) Object
+
+// Caller : runs colon functions, or builtins, for a CallingFunction. The
+// evaluator and the VM each call them as they call any other function, so
+// that runtime errors and stack traces look the same.
+type Caller interface {
+	CallFunction(function Object, args ...Object) Object
+}
+
+// ----------------------------------------------------------------------------
+
+// Signature : optional description of the arguments a builtin accepts,
+// checked by the evaluator before the builtin is called
+type Signature struct {
+	Params   []ObjectType // type of each parameter, "" accepts any type
+	Variadic bool         // if set, the last parameter may be given any number of times
+}
+
 // ----------------------------------------------------------------------------
 
 // BuiltIn : to provide a warpper around some
 // functions that are built into the colon interpreter
 type BuiltIn struct {
 	Bfunct BuiltInFunction
+	Cfunct CallingFunction // called instead of Bfunct if set
+	Name   string          // name the builtin is registered under
+	Sig    *Signature      // nil if the builtin checks its own arguments
 }
 
 // ObValue : BuiltIn
@@ -213,62 +345,170 @@ func (bin *BuiltIn) ObType() ObjectType {
 
 // ----------------------------------------------------------------------------
 
-// InputFunction : to provide a way to get user input from stdin
-type InputFunction struct {
-	InFunc func(env *Env, varname string, dtype DataType) Object
-	ENV    *Env
+// List : structure that wraps a list into an object
+type List struct {
+	Elements []Object
 }
 
-// ObValue : InputFunction
-func (bin *InputFunction) ObValue() string {
-	return "Builtin Function"
+// ObValue : ReturnValue
+func (l *List) ObValue() string {
+	return valueOf(l, map[Object]bool{})
 }
 
-// ObType : InputFunction
-func (bin *InputFunction) ObType() ObjectType {
-	return INPUT
+// ObType : ReturnValue
+func (l *List) ObType() ObjectType {
+	return LIST
 }
 
 // ----------------------------------------------------------------------------
 
-//DataType : To encode Datatype information; mainly required by the input function
-type DataType struct {
-	Dtype string
+// MapKey : identifies a key of a map. Keys of different types never
+// collide, so 1 and "1" are distinct keys.
+type MapKey struct {
+	Type  ObjectType
+	Value string
 }
 
-// ObValue : DataType
-func (dt *DataType) ObValue() string {
-	return "DATA-TYPE"
+// Hashable : implemented by the objects that can be used as map keys
+type Hashable interface {
+	Object
+	MapKey() MapKey
 }
 
-// ObType : DataType
-func (dt *DataType) ObType() ObjectType {
-	return BUILTIN
+// MapPair : a key of a map together with the value bound to it
+type MapPair struct {
+	Key   Object
+	Value Object
 }
 
-// ----------------------------------------------------------------------------
+// Map : structure that wraps a map into an object. Pairs are kept in the
+// order their keys were first inserted.
+type Map struct {
+	Pairs map[MapKey]*MapPair
+	Order []MapKey
+}
 
-// List : structure that wraps a list into an object
-type List struct {
-	Elements []Object
+// NewMap : constructs and returns an empty Map
+func NewMap() *Map {
+	return &Map{Pairs: map[MapKey]*MapPair{}, Order: []MapKey{}}
 }
 
-// ObValue : ReturnValue
-func (l *List) ObValue() string {
+// Get : returns the value bound to key
+func (m *Map) Get(key Hashable) (Object, bool) {
+	if pair, ok := m.Pairs[key.MapKey()]; ok {
+		return pair.Value, true
+	}
+	return nil, false
+}
+
+// Set : binds key to val, keeping the position of a key that was already present
+func (m *Map) Set(key Hashable, val Object) {
+	mk := key.MapKey()
+	if pair, ok := m.Pairs[mk]; ok {
+		pair.Value = val
+		return
+	}
+	m.Pairs[mk] = &MapPair{Key: key, Value: val}
+	m.Order = append(m.Order, mk)
+}
+
+// Delete : removes key from the map, returning false if it was not present
+func (m *Map) Delete(key Hashable) bool {
+	mk := key.MapKey()
+	if _, ok := m.Pairs[mk]; !ok {
+		return false
+	}
+	delete(m.Pairs, mk)
+	for k, v := range m.Order {
+		if v == mk {
+			m.Order = append(m.Order[:k], m.Order[k+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Entries : returns the pairs of the map in insertion order
+func (m *Map) Entries() []*MapPair {
+	entries := []*MapPair{}
+	for _, mk := range m.Order {
+		entries = append(entries, m.Pairs[mk])
+	}
+	return entries
+}
+
+// ObValue : Map
+func (m *Map) ObValue() string {
+	return valueOf(m, map[Object]bool{})
+}
+
+// ObType : Map
+func (m *Map) ObType() ObjectType {
+	return MAP
+}
+
+// valueOf : the ObValue of an object. Lists and maps can hold themselves
+// once their elements are assigned to, so a container that is already being
+// printed further up (in path) is printed as [...] or {...} instead.
+func valueOf(o Object, path map[Object]bool) string {
 	var str bytes.Buffer
-	str.WriteString("[")
-	elems := []string{}
-	for _, v := range l.Elements {
-		elems = append(elems, v.ObValue())
+	switch o := o.(type) {
+	case *List:
+		if path[o] {
+			return "[...]"
+		}
+		path[o] = true
+		defer delete(path, o)
+		str.WriteString("[")
+		elems := []string{}
+		for _, v := range o.Elements {
+			elems = append(elems, valueOf(v, path))
+		}
+		str.WriteString(strings.Join(elems, ", "))
+		str.WriteString("]")
+	case *Map:
+		if path[o] {
+			return "{...}"
+		}
+		path[o] = true
+		defer delete(path, o)
+		str.WriteString("{")
+		pairs := []string{}
+		for _, pair := range o.Entries() {
+			pairs = append(pairs, pair.Key.ObValue()+" = "+valueOf(pair.Value, path))
+		}
+		str.WriteString(strings.Join(pairs, ", "))
+		str.WriteString("}")
+	default:
+		return o.ObValue()
 	}
-	str.WriteString(strings.Join(elems, ", "))
-	str.WriteString("]")
 	return str.String()
 }
 
-// ObType : ReturnValue
-func (l *List) ObType() ObjectType {
-	return LIST
+// ----------------------------------------------------------------------------
+
+// Module : the namespace of an imported file, through which the bindings its
+// top-level code made are read
+type Module struct {
+	Path  string   // the file the module was loaded from, or the name of a standard module
+	Lines []string // the module's source, for error messages; nil for standard modules
+	Env   *Env     // the env the module's top-level code ran in
+}
+
+// Member : the value the module's top-level code bound to name
+func (m *Module) Member(name string) (Object, bool) {
+	val, ok := m.Env.bindings[name]
+	return val, ok
+}
+
+// ObValue : Module
+func (m *Module) ObValue() string {
+	return "MODULE " + m.Path
+}
+
+// ObType : Module
+func (m *Module) ObType() ObjectType {
+	return MODULE
 }
 
 // ----------------------------------------------------------------------------
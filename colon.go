@@ -1,10 +1,15 @@
 package main
 
 import (
+	"colon/colcheck"
 	"colon/colinterp"
+	"colon/collsp"
+	"colon/coltools"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 const (
@@ -15,16 +20,156 @@ const (
 )
 
 func main() {
-	if len(os.Args) != 2 {
+	args := os.Args[1:]
+	// imported modules not found next to the importing file are looked for
+	// in the directories listed in COLONPATH
+	config := colinterp.Config{ModulePath: filepath.SplitList(os.Getenv("COLONPATH"))}
+	if len(args) > 0 && args[0] == "--vm" {
+		config.VM = true
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		coltools.NewRepl(config)
+		return
+	}
+	if len(args) == 2 && args[0] == "build" {
+		build(args[1])
+		return
+	}
+	if len(args) == 2 && args[0] == "check" {
+		check(colinterp.NewRuntime(config), args[1])
+		return
+	}
+	if len(args) == 1 && args[0] == "lsp" {
+		if err := collsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) >= 2 && args[0] == "fmt" {
+		format(args[1:])
+		return
+	}
+	if len(args) != 1 {
+		usage()
+		return
+	}
+	run(colinterp.NewRuntime(config), args[0])
+}
+
+// build : writes the AST cache of a source file
+func build(filename string) {
+	cachename, err := colinterp.Build(filename)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(22)
+	}
+	fmt.Println("Wrote " + cachename)
+}
+
+// check : reports the problems the checker finds in a source file, exiting
+// with an error if any of them would make the file fail when run
+func check(rt *colinterp.Runtime, filename string) {
+	code, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Println("Error reading file : " + filename)
+		return
+	}
+	diagnostics, err := rt.Check(string(code))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(22)
+	}
+	errors := 0
+	for _, d := range diagnostics {
+		fmt.Println(d)
+		fmt.Println()
+		if d.Severity == colcheck.ERROR {
+			errors++
+		}
+	}
+	if len(diagnostics) > 0 {
+		fmt.Printf("%s : %d error(s), %d warning(s)\n", filename, errors, len(diagnostics)-errors)
+	}
+	if errors > 0 {
+		os.Exit(22)
+	}
+}
+
+// format : prints the canonical source of a file, or with -w rewrites the
+// file with it
+func format(args []string) {
+	write := args[0] == "-w"
+	if write {
+		args = args[1:]
+	}
+	if len(args) != 1 {
 		usage()
 		return
 	}
-	code, err := ioutil.ReadFile(os.Args[1])
+	code, err := ioutil.ReadFile(args[0])
 	if err != nil {
-		fmt.Println("Error reading file : " + os.Args[1])
+		fmt.Println("Error reading file : " + args[0])
 		return
 	}
-	colinterp.Interpret(string(code))
+	formatted, err := colinterp.Format(string(code))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(22)
+	}
+	if !write {
+		fmt.Print(formatted)
+		return
+	}
+	if err := ioutil.WriteFile(args[0], []byte(formatted), 0644); err != nil {
+		fmt.Println("Error writing file : " + args[0])
+		os.Exit(22)
+	}
+}
+
+// run : runs a source file, or an AST cache. A source file is run from its
+// cache when the cache was built from it, and a cache is only run when its
+// source file is missing or unchanged since it was built.
+func run(rt *colinterp.Runtime, filename string) {
+	var err error
+	if strings.HasSuffix(filename, colinterp.CacheExtension) {
+		err = runCache(rt, filename)
+	} else {
+		err = runSource(rt, filename)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(22)
+	}
+}
+
+func runSource(rt *colinterp.Runtime, filename string) error {
+	code, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Println("Error reading file : " + filename)
+		return nil
+	}
+	if cache := colinterp.FreshCache(filename, string(code)); cache != nil {
+		_, err = rt.RunCache(filename, cache)
+		return err
+	}
+	_, err = rt.RunFile(filename, string(code))
+	return err
+}
+
+func runCache(rt *colinterp.Runtime, cachename string) error {
+	source := colinterp.SourcePath(cachename)
+	if _, err := os.Stat(source); err != nil {
+		// no source to compare with, so the cache is all there is
+		cache, err := colinterp.ReadCacheFile(cachename)
+		if err != nil {
+			return fmt.Errorf("Error reading cache %s : %v", cachename, err)
+		}
+		_, err = rt.RunCache(source, cache)
+		return err
+	}
+	return runSource(rt, source)
 }
 
 func usage() {
@@ -38,6 +183,22 @@ func usage() {
 	fmt.Printf("Link to source code : %s\n", linkToSrc)
 	fmt.Println("------------------------------------------------------------------")
 	fmt.Println("Usage:")
-	fmt.Println("       colon <filename>.col")
+	fmt.Println("       colon [--vm]                  (starts the REPL)")
+	fmt.Println("       colon [--vm] <filename>.col")
+	fmt.Println("       colon [--vm] <filename>.colc   (runs an AST cache)")
+	fmt.Println("       colon build <filename>.col    (writes <filename>.colc)")
+	fmt.Println("       colon check <filename>.col    (reports problems without running)")
+	fmt.Println("       colon fmt [-w] <filename>.col (prints, or with -w rewrites, the")
+	fmt.Println("                                      file in the canonical format)")
+	fmt.Println("       colon lsp                     (serves the Language Server")
+	fmt.Println("                                      Protocol over stdin and stdout)")
+	fmt.Println()
+	fmt.Println("       --vm   compile to bytecode and run it on the virtual machine")
+	fmt.Println()
+	fmt.Println("       Imported modules are looked for next to the importing file, then")
+	fmt.Println("       in the directories listed in the COLONPATH environment variable.")
+	fmt.Println()
+	fmt.Println("       A .col file is run from its .colc cache when the cache was")
+	fmt.Println("       built from it. A stale cache is ignored and the source is run.")
 	fmt.Println("------------------------------------------------------------------")
 }
@@ -4,12 +4,11 @@ import (
 	ast "colon/colast"
 	tok "colon/coltok"
 	"fmt"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
-// loc : To store the contents of the source file. For better error reporting
-var loc []string
-
 // defining a couple of function types.
 type (
 	prefixFunc func() ast.Expression
@@ -33,6 +32,9 @@ var precedenceTable = map[tok.TokenType]int{
 	// array indexing operator
 	tok.LSB: INDEX,
 
+	// module member operator
+	tok.DOT: INDEX,
+
 	// function call operator
 	tok.LPR: FCALL,
 
@@ -57,23 +59,41 @@ var precedenceTable = map[tok.TokenType]int{
 	tok.POW: POWER,
 }
 
+// ParseError : an error found while parsing. Line and Column are 1-based,
+// Source holds the text of the offending line.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+	Source string
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("Error on line %d, column %d : %s", e.Line, e.Column, e.Msg)
+	if e.Source != "" {
+		msg += "\n\n" + PointAt(e.Source, e.Column)
+	}
+	return msg
+}
+
 // Parser : Current state of the parser
 type Parser struct {
 	tokens          []tok.Token
+	lines           []string // the lines of the source, for error messages
 	currentToken    int
 	peekedToken     int
-	errors          []string
+	errors          []*ParseError
+	loopDepth       int // number of loops around the current token, within the current function
 	prefixFunctions map[tok.TokenType]prefixFunc
 	infixFunctions  map[tok.TokenType]infixFunc
 }
 
 // CreateParserState : to create a new parser state and initialize it
 func CreateParserState(toks []tok.Token, locs []string) *Parser {
-	p := &Parser{tokens: toks}
+	p := &Parser{tokens: toks, lines: locs}
 	p.currentToken = 0
 	p.peekedToken = 1
-	p.errors = []string{}
-	loc = locs
+	p.errors = []*ParseError{}
 	p.prefixFunctions = make(map[tok.TokenType]prefixFunc)
 	p.infixFunctions = make(map[tok.TokenType]infixFunc)
 
@@ -87,9 +107,11 @@ func CreateParserState(toks []tok.Token, locs []string) *Parser {
 	p.registerPrefixFunc(tok.LNT, p.parsePrefixExpression)
 	p.registerPrefixFunc(tok.LPR, p.parseGroupedExpression)
 	p.registerPrefixFunc(tok.IFB, p.parseIfExpression)
+	p.registerPrefixFunc(tok.TRB, p.parseTryExpression)
 	p.registerPrefixFunc(tok.FNB, p.parseFunctionExpression)
 	p.registerPrefixFunc(tok.LPB, p.parseLoopStatement)
 	p.registerPrefixFunc(tok.LSB, p.parseArray)
+	p.registerPrefixFunc(tok.LBR, p.parseMap)
 	// p.registerPrefixFunc(tok.CMT, p.parseComment)
 
 	// registering all the valid INFIX tokens
@@ -109,6 +131,7 @@ func CreateParserState(toks []tok.Token, locs []string) *Parser {
 	p.registerInfixFunc(tok.LOR, p.parseInfixExpression)
 	p.registerInfixFunc(tok.LPR, p.parseFunctionCall)
 	p.registerInfixFunc(tok.LSB, p.parseArrayIndexExpression)
+	p.registerInfixFunc(tok.DOT, p.parseMemberExpression)
 
 	return p
 }
@@ -123,13 +146,13 @@ func (p *Parser) advanceToken() {
 }
 
 // Errors : Returns a list of errors
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
 // Parse : function that parses a stream of tokens and returns the ast produced
 func (p *Parser) Parse() *ast.Program {
-	program := &ast.Program{}
+	program := &ast.Program{Lines: p.lines}
 	program.Statements = []ast.Statement{}
 	for !p.currTokIs(tok.EOF) {
 		statement := p.parseStatement()
@@ -148,6 +171,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseVarStatement()
 	case tok.RET:
 		return p.parseReturnStatement()
+	case tok.BRK, tok.CNT:
+		return p.parseLoopControlStatement()
+	case tok.IMP:
+		return p.parseImportStatement()
 	case tok.EOL:
 		return nil
 	default:
@@ -159,7 +186,7 @@ func (p *Parser) parseStatement() ast.Statement {
 				Statement and Expression parsing functions
   --------------------------------------------------------------------------- */
 
-func (p *Parser) parseVarStatement() *ast.VarStatement {
+func (p *Parser) parseVarStatement() ast.Statement {
 	statement := &ast.VarStatement{Token: p.tokens[p.currentToken]}
 	if !p.NextTokenIs(tok.BLK) {
 		return nil
@@ -167,6 +194,10 @@ func (p *Parser) parseVarStatement() *ast.VarStatement {
 	if !p.NextTokenIs(tok.IDN) {
 		return nil
 	}
+	// v: name[index] = value
+	if p.peekTokIs(tok.LSB) {
+		return p.parseAssignStatement(statement.Token, p.parseExpression(LOWEST))
+	}
 	statement.Name = &ast.Identifier{
 		Token: p.tokens[p.currentToken],
 		Value: p.tokens[p.currentToken].Literal,
@@ -193,14 +224,111 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return statement
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+// parseLoopControlStatement : parses break and continue, which are only
+// allowed inside loops
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var statement ast.Statement
+	if p.currTokIs(tok.BRK) {
+		statement = &ast.BreakStatement{Token: p.tokens[p.currentToken]}
+	} else {
+		statement = &ast.ContinueStatement{Token: p.tokens[p.currentToken]}
+	}
+	if p.loopDepth == 0 {
+		p.OutsideLoopError()
+	}
+	if p.peekTokIs(tok.EOL) {
+		p.advanceToken()
+	}
+	return statement
+}
+
+// parseImportStatement : parses import "path", which names the module after
+// its file, and import "path" as name
+func (p *Parser) parseImportStatement() ast.Statement {
+	statement := &ast.ImportStatement{Token: p.tokens[p.currentToken]}
+	if !p.NextTokenIs(tok.STR) {
+		return nil
+	}
+	statement.Path = p.tokens[p.currentToken].Literal
+	if p.peekTokIs(tok.AS) {
+		p.advanceToken()
+		if !p.NextTokenIs(tok.IDN) {
+			return nil
+		}
+		statement.Aliased = true
+		statement.Name = &ast.Identifier{
+			Token: p.tokens[p.currentToken],
+			Value: p.tokens[p.currentToken].Literal,
+		}
+	} else {
+		name, ok := moduleName(statement.Path)
+		if !ok {
+			p.ModuleNameError(name)
+			return nil
+		}
+		statement.Name = &ast.Identifier{Token: p.tokens[p.currentToken], Value: name}
+	}
+	if p.peekTokIs(tok.EOL) {
+		p.advanceToken()
+	}
+	return statement
+}
+
+// moduleName : the name a module imported without "as" is bound to, which is
+// its file name without the extension, and whether that is a valid name
+func moduleName(path string) (string, bool) {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	// t and c are keywords only where a try or its catch starts
+	if name == "" || (tok.IsKeyword(name) && name != "t" && name != "c") || name == "true" || name == "false" || name == "TRUE" || name == "FALSE" {
+		return name, false
+	}
+	for k := 0; k < len(name); k++ {
+		if !tok.IsLetter(name[k]) {
+			return name, false
+		}
+	}
+	return name, true
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	statement := &ast.ExpressionStatement{Token: p.tokens[p.currentToken]}
 	statement.Expression = p.parseExpression(LOWEST)
+	if p.peekTokIs(tok.ASN) {
+		return p.parseAssignStatement(statement.Token, statement.Expression)
+	}
 	// fmt.Print("~~~>")
 	// fmt.Println(p.tokens[p.currentToken])
 	return statement
 }
 
+// parseAssignStatement : parses the "= value" part of a reassignment of a
+// name or of an element of a list or map; the current token is the last one
+// of the target
+func (p *Parser) parseAssignStatement(t tok.Token, target ast.Expression) ast.Statement {
+	validTarget := false
+	switch target.(type) {
+	case *ast.Identifier, *ast.ArrayIndexExpression:
+		validTarget = true
+	}
+	if !validTarget {
+		p.InvalidAssignmentTargetError()
+	}
+	statement := &ast.AssignStatement{Token: t, Target: target}
+	if !p.NextTokenIs(tok.ASN) {
+		return nil
+	}
+	p.advanceToken()
+	statement.Value = p.parseExpression(LOWEST)
+	if p.peekTokIs(tok.EOL) {
+		p.advanceToken()
+	}
+	if !validTarget {
+		return nil
+	}
+	return statement
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{
 		Token: p.tokens[p.currentToken],
@@ -257,7 +385,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	// fmt.Print("--->")
 	// fmt.Println(p.tokens[p.currentToken])
 	for !p.peekTokIs(tok.EOL) && precedence < p.peekPrecedence() {
-		infix := p.infixFunctions[p.tokens[p.peekedToken].TokType]
+		infix := p.infixFunctions[p.peekToken().TokType]
 		if infix == nil {
 			return leftExpression
 		}
@@ -343,6 +471,35 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{
+		Token: p.tokens[p.currentToken],
+	}
+	if !p.NextTokenIs(tok.BLK) {
+		return nil
+	}
+	expression.TryBody = p.parseBlock(tok.TRE)
+
+	// the catch may start on the line the try ends on, or on a later one
+	p.removeExtraNewLines()
+	if !p.NextTokenIs(tok.CTB) || !p.NextTokenIs(tok.LPR) || !p.NextTokenIs(tok.IDN) {
+		return nil
+	}
+	expression.ErrName = &ast.Identifier{
+		Token: p.tokens[p.currentToken],
+		Value: p.tokens[p.currentToken].Literal,
+	}
+	if !p.NextTokenIs(tok.RPR) {
+		p.ClosedParenMissingError()
+		return nil
+	}
+	if !p.NextTokenIs(tok.BLK) {
+		return nil
+	}
+	expression.CatchBody = p.parseBlock(tok.CTE)
+	return expression
+}
+
 func (p *Parser) parseBlock(endToken tok.TokenType) *ast.Block {
 	block := &ast.Block{
 		Token: p.tokens[p.currentToken],
@@ -375,7 +532,11 @@ func (p *Parser) parseFunctionExpression() ast.Expression {
 	if !p.NextTokenIs(tok.BLK) {
 		return nil
 	}
+	// loops around a function definition do not extend into its body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	expression.FuncBody = p.parseBlock(tok.FNE)
+	p.loopDepth = loopDepth
 	return expression
 }
 
@@ -448,14 +609,55 @@ func (p *Parser) parseLoopStatement() ast.Expression {
 	if !p.NextTokenIs(tok.LPR) {
 		return nil
 	}
+	// l (x in xs) : or l (k, x in xs) :
+	if p.peekTokIs(tok.IDN) && (p.tokenTypeAt(2) == tok.IN ||
+		(p.tokenTypeAt(2) == tok.COM && p.tokenTypeAt(3) == tok.IDN && p.tokenTypeAt(4) == tok.IN)) {
+		return p.parseForEach(loopExpression.Token)
+	}
 	loopExpression.Condition = p.parseGroupedExpression()
 	if !p.NextTokenIs(tok.BLK) {
 		return nil
 	}
+	p.loopDepth++
 	loopExpression.LoopBody = p.parseBlock(tok.LPE)
+	p.loopDepth--
 	return loopExpression
 }
 
+func (p *Parser) parseForEach(loopToken tok.Token) ast.Expression {
+	forEach := &ast.ForEachExpression{Token: loopToken}
+	p.advanceToken()
+	forEach.Value = &ast.Identifier{
+		Token: p.tokens[p.currentToken],
+		Value: p.tokens[p.currentToken].Literal,
+	}
+	if p.peekTokIs(tok.COM) {
+		p.advanceToken()
+		p.advanceToken()
+		forEach.Key = forEach.Value
+		forEach.Value = &ast.Identifier{
+			Token: p.tokens[p.currentToken],
+			Value: p.tokens[p.currentToken].Literal,
+		}
+	}
+	if !p.NextTokenIs(tok.IN) {
+		return nil
+	}
+	p.advanceToken()
+	forEach.Collection = p.parseExpression(LOWEST)
+	if !p.NextTokenIs(tok.RPR) {
+		p.ClosedParenMissingError()
+		return nil
+	}
+	if !p.NextTokenIs(tok.BLK) {
+		return nil
+	}
+	p.loopDepth++
+	forEach.LoopBody = p.parseBlock(tok.LPE)
+	p.loopDepth--
+	return forEach
+}
+
 func (p *Parser) parseArray() ast.Expression {
 	array := &ast.Array{
 		Token:    p.tokens[p.currentToken],
@@ -478,6 +680,44 @@ func (p *Parser) parseArray() ast.Expression {
 	return array
 }
 
+// parseMap : map literals may be spread over several lines, so newlines
+// around keys and values are skipped
+func (p *Parser) parseMap() ast.Expression {
+	mapLit := &ast.Map{
+		Token:  p.tokens[p.currentToken],
+		Keys:   []ast.Expression{},
+		Values: []ast.Expression{},
+	}
+	p.removeExtraNewLines()
+	if p.peekTokIs(tok.RBR) {
+		p.advanceToken()
+		return mapLit
+	}
+	for {
+		p.advanceToken()
+		key := p.parseExpression(LOWEST)
+		if !p.NextTokenIs(tok.ASN) {
+			return nil
+		}
+		p.advanceToken()
+		mapLit.Keys = append(mapLit.Keys, key)
+		mapLit.Values = append(mapLit.Values, p.parseExpression(LOWEST))
+		p.removeExtraNewLines()
+		if !p.peekTokIs(tok.COM) {
+			break
+		}
+		p.advanceToken()
+		p.removeExtraNewLines()
+		if p.peekTokIs(tok.RBR) {
+			break
+		}
+	}
+	if !p.NextTokenIs(tok.RBR) {
+		return nil
+	}
+	return mapLit
+}
+
 func (p *Parser) parseArrayIndexExpression(leftExpr ast.Expression) ast.Expression {
 	arrIndExp := &ast.ArrayIndexExpression{
 		Token:          p.tokens[p.currentToken],
@@ -491,6 +731,27 @@ func (p *Parser) parseArrayIndexExpression(leftExpr ast.Expression) ast.Expressi
 	return arrIndExp
 }
 
+// parseMemberExpression : parses namespace.name
+func (p *Parser) parseMemberExpression(leftExpr ast.Expression) ast.Expression {
+	memberExp := &ast.MemberExpression{
+		Token:          p.tokens[p.currentToken],
+		LeftExpression: leftExpr,
+	}
+	// keywords that are words may be members too, as in math.e, for the
+	// standard modules bind names that colon code cannot declare
+	next := p.peekToken()
+	if next.TokType != tok.IDN && !(tok.IsKeyword(next.Literal) && tok.IsLetter(next.Literal[0])) {
+		p.ExpectedTokenError(tok.IDN)
+		return nil
+	}
+	p.advanceToken()
+	memberExp.Member = &ast.Identifier{
+		Token: p.tokens[p.currentToken],
+		Value: p.tokens[p.currentToken].Literal,
+	}
+	return memberExp
+}
+
 /* --------------------------------------------------------------------------
 							Helper functions
   --------------------------------------------------------------------------- */
@@ -513,6 +774,24 @@ func (p *Parser) peekTokIs(tokType tok.TokenType) bool {
 	return false
 }
 
+// peekToken : returns the next token, or the last one, which is EOF, when the
+// current token is already the last
+func (p *Parser) peekToken() tok.Token {
+	if p.peekedToken < len(p.tokens) {
+		return p.tokens[p.peekedToken]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+// tokenTypeAt : returns the type of the token offset places after the current
+// one, or EOF past the end of the tokens
+func (p *Parser) tokenTypeAt(offset int) tok.TokenType {
+	if p.currentToken+offset < len(p.tokens) {
+		return p.tokens[p.currentToken+offset].TokType
+	}
+	return tok.EOF
+}
+
 // NextTokenIs : moves to the next token only it is of the desired token type
 func (p *Parser) NextTokenIs(t tok.TokenType) bool {
 	if p.peekTokIs(t) {
@@ -573,38 +852,79 @@ func (p *Parser) registerInfixFunc(toktype tok.TokenType, infixFunction infixFun
 
 // ExpectedTokenError : happens when the parser is expecting a particular token but recieves some other token
 func (p *Parser) ExpectedTokenError(et tok.TokenType) {
-	err := fmt.Sprintf("\nError on line %d : Expecting token of type %s but got %s instead", p.tokens[p.peekedToken].Line, et.String(), p.tokens[p.peekedToken].TokType.String())
-	err += "\n\n\t" + loc[p.tokens[p.currentToken].Line]
-	p.errors = append(p.errors, err)
+	p.addError(p.peekToken(), fmt.Sprintf("Expecting token of type %s but got %s instead", et.String(), p.peekToken().TokType.String()))
 }
 
 // ClosedParenMissingError : happens when an expression is missing a right parenthesis
 func (p *Parser) ClosedParenMissingError() {
-	err := fmt.Sprintf("\nError on line %d : Closing parenthesis ')' expected but not found.", p.tokens[p.currentToken].Line)
-	err += "\n\n\t" + loc[p.tokens[p.currentToken].Line]
-	p.errors = append(p.errors, err)
+	p.addError(p.tokens[p.currentToken], "Closing parenthesis ')' expected but not found.")
 }
 
 // LiteralConversionError : happens when parser is unable to convert a number to the intended target data-type
 func (p *Parser) LiteralConversionError(literal, target string) {
-	err := fmt.Sprintf("\nError on line %d : Could not parse %q as %q", p.tokens[p.currentToken].Line, literal, target)
-	err += "\n\n\t" + loc[p.tokens[p.currentToken].Line]
-	p.errors = append(p.errors, err)
+	p.addError(p.tokens[p.currentToken], fmt.Sprintf("Could not parse %q as %q", literal, target))
 }
 
 // UndefinedPrefixExpressionError : happens when an illegal token is encountered in place of a valid prefix token in an token in an expression
 // for example, if the programmer has the expression -> (* 42) -> this makes no sense because '*' is not a valid prefix token
 func (p *Parser) UndefinedPrefixExpressionError(t tok.TokenType) {
-	err := fmt.Sprintf("\nError on line %d : %q is not a valid 'prefix' expression/token.", p.tokens[p.currentToken].Line, t.String())
-	err += "\n\n\t" + loc[p.tokens[p.currentToken].Line]
-	p.errors = append(p.errors, err)
+	p.addError(p.tokens[p.currentToken], fmt.Sprintf("%q is not a valid 'prefix' expression/token.", t.String()))
 }
 
 // WrongDataTypeWithOperatorError : happens when an operator is used with operands that the operator does not operate on
 func (p *Parser) WrongDataTypeWithOperatorError(expected, operator string) {
-	err := fmt.Sprintf("\nError on line %d : Operator %q can be used with operands of type %s only.", p.tokens[p.currentToken].Line, operator, expected)
-	err += "\n\n\t" + loc[p.tokens[p.currentToken].Line]
-	p.errors = append(p.errors, err)
+	p.addError(p.tokens[p.currentToken], fmt.Sprintf("Operator %q can be used with operands of type %s only.", operator, expected))
+}
+
+// InvalidAssignmentTargetError : happens when the left side of an '=' is neither a name nor an indexing expression
+func (p *Parser) InvalidAssignmentTargetError() {
+	p.addError(p.peekToken(), "Only names and elements of lists and maps can be assigned to with '='.")
+}
+
+// ModuleNameError : happens when a module imported without "as" has a file name that is not a valid name
+func (p *Parser) ModuleNameError(name string) {
+	p.addError(p.tokens[p.currentToken], fmt.Sprintf("%q cannot be used as the name of a module. Name it with 'import \"...\" as name'", name))
+}
+
+// OutsideLoopError : happens when break or continue is used outside of a loop
+func (p *Parser) OutsideLoopError() {
+	p.addError(p.tokens[p.currentToken], fmt.Sprintf("%q can only be used inside a loop.", p.tokens[p.currentToken].Literal))
+}
+
+// addError : records an error located at the given token
+func (p *Parser) addError(t tok.Token, msg string) {
+	p.errors = append(p.errors, &ParseError{
+		Line:   t.Line + 1,
+		Column: t.Column + 1,
+		Msg:    msg,
+		Source: SourceLine(p.lines, t.Line),
+	})
+}
+
+// SourceLine : returns the text of a 0-based line of the source lines, or ""
+// if the line does not exist
+func SourceLine(lines []string, line int) string {
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return lines[line]
+}
+
+// PointAt : formats a source line for an error message, with a caret under
+// the 1-based column. Tabs before the column are kept so the caret lines up.
+func PointAt(source string, column int) string {
+	if source == "" {
+		return ""
+	}
+	pad := []byte{}
+	for k := 0; k < column-1 && k < len(source); k++ {
+		if source[k] == '\t' {
+			pad = append(pad, '\t')
+		} else {
+			pad = append(pad, ' ')
+		}
+	}
+	return "\t" + source + "\n\t" + string(pad) + "^"
 }
 
 /* --------------------------------------------------------------------------
@@ -616,7 +936,7 @@ func (p *Parser) ReportErrors() []string {
 	if len(p.errors) > 0 {
 		report := []string{}
 		for _, v := range p.errors {
-			report = append(report, v)
+			report = append(report, "\n"+v.Error())
 		}
 		// report = append(report, "\n")
 		return report
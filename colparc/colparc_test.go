@@ -0,0 +1,69 @@
+package colparc
+
+import (
+	lex "colon/collex"
+	"strings"
+	"testing"
+)
+
+func parse(code string) []*ParseError {
+	l := lex.CreateLexerState(code)
+	p := CreateParserState(l.Lex(), l.SourceLines())
+	p.Parse()
+	return p.Errors()
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		line int
+		msg  string
+	}{
+		{"v: a = (1 + 2\n", 1, "Expecting token of type RIGHT_PARENTHESES"},
+		{"print(1)\nv a = 1\n", 2, "Expecting token of type"},
+		{"v: a = 1.\n", 1, "Could not parse"},
+		{"v: a = 1\ng() = 2\n", 2, "Only names and elements of lists and maps can be assigned to"},
+		{"v: a = 1\na + 1 = 2\n", 2, "Only names and elements of lists and maps can be assigned to"},
+		{"break\n", 1, `"break" can only be used inside a loop.`},
+		{"v: a = 1\ni(a == 1):\n    continue\n:i\n", 3, `"continue" can only be used inside a loop.`},
+		// loops around a function definition do not extend into its body
+		{"l(true):\n    v: g = f():\n        break\n    :f\n:l\n", 3, `"break" can only be used inside a loop.`},
+		{"import \"lib/my-lib.col\"\n", 1, `"my-lib" cannot be used as the name of a module`},
+		{"import \"v.col\"\n", 1, `"v" cannot be used as the name of a module`},
+		{"import \"lib\" as 1\n", 1, "Expecting token of type"},
+		{"import \"lib\"\nprint(lib.)\n", 2, "Expecting token of type"},
+	}
+	for _, tt := range tests {
+		errs := parse(tt.code)
+		if len(errs) == 0 {
+			t.Errorf("%q : no errors", tt.code)
+			continue
+		}
+		if errs[0].Line != tt.line || !strings.Contains(errs[0].Msg, tt.msg) {
+			t.Errorf("%q : got line %d %q, want line %d %q", tt.code, errs[0].Line, errs[0].Msg, tt.line, tt.msg)
+		}
+	}
+}
+
+func TestParseUnfinishedInput(t *testing.T) {
+	// none of these end in a newline, so the parser runs into the end of the
+	// tokens while it still expects more
+	for _, code := range []string{"print(", "v: xs = [1,", "v: a = 1 +", "i(", "v: g = f(x", "xs[0] =", "a =", "l(x in", "l(k, x in xs", "import", "import \"lib\" as", "lib."} {
+		if errs := parse(code); len(errs) == 0 {
+			t.Errorf("%q : no errors", code)
+		}
+	}
+}
+
+func TestParseErrorColumn(t *testing.T) {
+	errs := parse("v: a = 1\nv: b = (a + 2\n")
+	if len(errs) == 0 {
+		t.Fatal("no errors")
+	}
+	if errs[0].Line != 2 || errs[0].Column != 14 || errs[0].Source != "v: b = (a + 2" {
+		t.Errorf("got %d:%d %q", errs[0].Line, errs[0].Column, errs[0].Source)
+	}
+	if got, want := PointAt("\tv: b", 3), "\t\tv: b\n\t\t ^"; got != want {
+		t.Errorf("PointAt : got %q, want %q", got, want)
+	}
+}
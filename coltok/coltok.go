@@ -14,6 +14,8 @@ const (
 	RPR // RIGHT PARENTHESIS
 	LSB // LEFT SQUARE BRACKET
 	RSB // RIGHT SQUARE BRACKET
+	LBR // LEFT BRACE
+	RBR // RIGHT BRACE
 
 	PLS // PLUS
 	MIN // MINUS
@@ -31,6 +33,7 @@ const (
 
 	ASN // ASSIGNMENT
 	COM // COMMA
+	DOT // DOT, for members of modules
 
 	LND // LOGICAL_AND
 	LOR // LOGICAL_OR
@@ -47,7 +50,16 @@ const (
 	LPE // LOOP END
 	FNB // FUNCTION BEGIN
 	FNE // FUNCTION END
+	TRB // TRY BEGIN
+	TRE // TRY END
+	CTB // CATCH BEGIN
+	CTE // CATCH END
 	RET // RETURN
+	BRK // BREAK
+	CNT // CONTINUE
+	IN  // IN, for for-each loops
+	IMP // IMPORT
+	AS  // AS, for naming imported modules
 
 	BLK // BLOCK
 	EOL // END OF LINE
@@ -122,14 +134,38 @@ func (t TokenType) String() string {
 		return "BEGIN: FUNCTION"
 	case FNE:
 		return "END FUNCTION"
+	case TRB:
+		return "BEGIN: TRY"
+	case TRE:
+		return "END: TRY"
+	case CTB:
+		return "BEGIN: CATCH"
+	case CTE:
+		return "END: CATCH"
 	case RET:
 		return "RETURN"
+	case BRK:
+		return "BREAK"
+	case CNT:
+		return "CONTINUE"
+	case IN:
+		return "IN"
+	case IMP:
+		return "IMPORT"
+	case AS:
+		return "AS"
 	case COM:
 		return "COMMA"
+	case DOT:
+		return "DOT"
 	case LSB:
 		return "LEFT SQ BRACKET"
 	case RSB:
 		return "RIGHT SQ BRACKET"
+	case LBR:
+		return "LEFT BRACE"
+	case RBR:
+		return "RIGHT BRACE"
 	case EOF:
 		return "EOF"
 	case EOL:
@@ -151,7 +187,17 @@ var Keywords map[string]TokenType = map[string]TokenType{
 	":l": LPE,
 	"f":  FNB,
 	":f": FNE,
+	"t":  TRB,
+	":t": TRE,
+	"c":  CTB,
+	":c": CTE,
 	"r":  RET,
+
+	"break":    BRK,
+	"continue": CNT,
+	"in":       IN,
+	"import":   IMP,
+	"as":       AS,
 }
 
 // Token : properties
@@ -159,6 +205,18 @@ type Token struct {
 	TokType TokenType
 	Literal string
 	Line    int
+	Column  int
+}
+
+// Position : where a token starts in the source. Line and Column are 0-based.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Pos : the position of the token
+func (t Token) Pos() Position {
+	return Position{Line: t.Line, Column: t.Column}
 }
 
 // NewToken : to assemble a token 'object'
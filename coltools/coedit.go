@@ -0,0 +1,266 @@
+package coltools
+
+import (
+	"bufio"
+	tok "colon/coltok"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maximum number of entries kept in the history file
+const historyLimit = 1000
+
+// lineReader : reads one line of REPL input after showing a prompt
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// plainReader : reads whole lines, for input that is not a terminal
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (pr *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(pr.out, prompt)
+	line, err := pr.in.ReadString('\n')
+	if err != nil && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// lineEditor : reads lines from a terminal in raw mode, supporting cursor
+// movement, history and identifier completion
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       uintptr
+	history  *history
+	complete func(prefix string) []string // candidates for completing prefix
+}
+
+// errInterrupted : returned by readLine when the line is abandoned with ctrl-c
+var errInterrupted = fmt.Errorf("interrupted")
+
+func (ed *lineEditor) readLine(prompt string) (string, error) {
+	state, err := makeRaw(ed.fd)
+	if err != nil {
+		return (&plainReader{in: ed.in, out: ed.out}).readLine(prompt)
+	}
+	defer restoreTerm(ed.fd, state)
+
+	buf := []rune{}
+	pos := 0
+	histPos := len(ed.history.entries)
+	draft := ""
+	redraw := func() {
+		fmt.Fprintf(ed.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(ed.out, "\x1b[%dD", back)
+		}
+	}
+	recall := func(to int) {
+		if to < 0 || to > len(ed.history.entries) {
+			return
+		}
+		if histPos == len(ed.history.entries) {
+			draft = string(buf)
+		}
+		histPos = to
+		if to == len(ed.history.entries) {
+			buf = []rune(draft)
+		} else {
+			buf = []rune(ed.history.entries[to])
+		}
+		pos = len(buf)
+	}
+
+	fmt.Fprint(ed.out, prompt)
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(ed.out, "\r\n")
+			return string(buf), err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(ed.out, "\r\n")
+			return string(buf), nil
+		case 3: // ctrl-c
+			fmt.Fprint(ed.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // ctrl-d
+			if len(buf) == 0 {
+				fmt.Fprint(ed.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // ctrl-a
+			pos = 0
+		case 5: // ctrl-e
+			pos = len(buf)
+		case 11: // ctrl-k
+			buf = buf[:pos]
+		case 21: // ctrl-u
+			buf = buf[pos:]
+			pos = 0
+		case '\t':
+			buf, pos = ed.completeAt(buf, pos)
+		case 27: // escape sequences for the arrow, home, end and delete keys
+			seq := ed.readEscape()
+			switch seq {
+			case "[A", "OA":
+				recall(histPos - 1)
+			case "[B", "OB":
+				recall(histPos + 1)
+			case "[C", "OC":
+				if pos < len(buf) {
+					pos++
+				}
+			case "[D", "OD":
+				if pos > 0 {
+					pos--
+				}
+			case "[H", "OH", "[1~", "[7~":
+				pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				pos = len(buf)
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r < 32 {
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+		}
+		redraw()
+	}
+}
+
+// readEscape : reads the rest of an escape sequence, e.g. "[A" for the up arrow
+func (ed *lineEditor) readEscape() string {
+	seq := ""
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return seq
+		}
+		seq += string(r)
+		// sequences end with a letter or '~', after the leading '[' or 'O'
+		if len(seq) > 1 && (r == '~' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')) {
+			return seq
+		}
+		if len(seq) == 1 && r != '[' && r != 'O' {
+			return seq
+		}
+	}
+}
+
+// completeAt : completes the identifier ending at pos. A single candidate is
+// inserted whole; several candidates are listed and their common prefix inserted.
+func (ed *lineEditor) completeAt(buf []rune, pos int) ([]rune, int) {
+	start := pos
+	for start > 0 && buf[start-1] < 128 && tok.IsLetter(byte(buf[start-1])) {
+		start--
+	}
+	prefix := string(buf[start:pos])
+	if prefix == "" || ed.complete == nil {
+		return buf, pos
+	}
+	candidates := ed.complete(prefix)
+	if len(candidates) == 0 {
+		return buf, pos
+	}
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(candidates) > 1 && common == prefix {
+		fmt.Fprintf(ed.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+	insert := []rune(common[len(prefix):])
+	buf = append(buf[:pos], append(insert, buf[pos:]...)...)
+	return buf, pos + len(insert)
+}
+
+// completions : returns the sorted names in names that start with prefix
+func completions(prefix string, names ...[]string) []string {
+	seen := map[string]bool{}
+	matches := []string{}
+	for _, list := range names {
+		for _, name := range list {
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				matches = append(matches, name)
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// history : lines entered in the REPL, kept in a file across sessions
+type history struct {
+	entries []string
+	path    string
+}
+
+// loadHistory : reads the history file in the user's home directory. A
+// missing or unreadable file gives an empty history.
+func loadHistory() *history {
+	h := &history{}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return h
+	}
+	h.path = filepath.Join(home, ".colon_history")
+	data, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[len(h.entries)-historyLimit:]
+	}
+	return h
+}
+
+// add : appends a line to the history and to the history file
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == line) {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
@@ -0,0 +1,72 @@
+package coltools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompletions(t *testing.T) {
+	got := completions("pr", []string{"print", "prod", "sum"}, []string{"print", "pr"})
+	if want := []string{"pr", "print", "prod"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCompleteAt(t *testing.T) {
+	var out strings.Builder
+	ed := &lineEditor{out: &out, complete: func(prefix string) []string {
+		return completions(prefix, []string{"print", "prime", "total"})
+	}}
+	tests := []struct {
+		buf  string
+		pos  int
+		want string
+	}{
+		{"v: a = tot", 10, "v: a = total"},
+		{"pr(1)", 2, "pri(1)"},
+		{"v: a = ", 7, "v: a = "},
+		{"xyz", 3, "xyz"},
+	}
+	for _, tt := range tests {
+		buf, pos := ed.completeAt([]rune(tt.buf), tt.pos)
+		if string(buf) != tt.want || pos != tt.pos+len(tt.want)-len(tt.buf) {
+			t.Errorf("%q at %d : got %q at %d, want %q", tt.buf, tt.pos, string(buf), pos, tt.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	home, err := ioutil.TempDir("", "colon-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	h := loadHistory()
+	for _, line := range []string{"v: a = 1", "v: a = 1", "  ", "print(a)"} {
+		h.add(line)
+	}
+	if want := []string{"v: a = 1", "print(a)"}; !reflect.DeepEqual(h.entries, want) {
+		t.Errorf("entries : got %q, want %q", h.entries, want)
+	}
+	if got := loadHistory().entries; !reflect.DeepEqual(got, h.entries) {
+		t.Errorf("reloaded : got %q, want %q", got, h.entries)
+	}
+
+	lines := make([]string, historyLimit+10)
+	for k := range lines {
+		lines[k] = "print(1)"
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".colon_history"), []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(loadHistory().entries); got != historyLimit {
+		t.Errorf("got %d entries, want %d", got, historyLimit)
+	}
+}
@@ -2,39 +2,277 @@ package coltools
 
 import (
 	"bufio"
+	ast "colon/colast"
+	"colon/colinterp"
 	lex "colon/collex"
-	par "colon/colparc"
+	obj "colon/colobj"
+	tok "colon/coltok"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 )
 
-// NewRepl : starts a new colon REPL
-func NewRepl() {
-	prompt := "::> "
-	input := ""
+const (
+	prompt     = "::> "
+	contPrompt = "... "
+)
+
+// the meta-commands understood by the REPL, with their descriptions
+var metaCommands = [][2]string{
+	{":env", "list the bindings in the global env"},
+	{":type <expr>", "evaluate an expression and show the type of its value"},
+	{":ast <code>", "show the syntax tree of some code"},
+	{":tokens <code>", "show the tokens of some code"},
+	{":load <file>", "run a file in the current env"},
+	{":reset", "discard all bindings"},
+	{":help", "show this list"},
+	{"q:", "quit"},
+}
+
+// repl : the state of a running REPL
+type repl struct {
+	config colinterp.Config
+	rt     *colinterp.Runtime
+	reader *bufio.Reader
+	out    io.Writer
+	lines  lineReader
+}
+
+// NewRepl : starts a new colon REPL on the process's stdin and stdout, with
+// runtimes made from config. On a terminal, lines can be edited, recalled
+// from the history kept in ~/.colon_history, and completed with tab.
+func NewRepl(config colinterp.Config) {
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("COLON v1.0.0")
+	r := newRepl(reader, os.Stdout)
+	r.config = config
+	r.reset()
+	if state, err := makeRaw(os.Stdin.Fd()); err == nil {
+		restoreTerm(os.Stdin.Fd(), state)
+		r.lines = &lineEditor{
+			in:       reader,
+			out:      os.Stdout,
+			fd:       os.Stdin.Fd(),
+			history:  loadHistory(),
+			complete: r.complete,
+		}
+	}
+	r.run()
+}
+
+// RunRepl : runs a colon REPL reading from in and writing to out, until
+// "q:" or the end of the input. Every input is evaluated in the same env,
+// and inputs with unfinished f, l, i, e, t or c blocks are continued on the
+// following lines.
+func RunRepl(in io.Reader, out io.Writer) {
+	newRepl(bufio.NewReader(in), out).run()
+}
+
+func newRepl(reader *bufio.Reader, out io.Writer) *repl {
+	r := &repl{reader: reader, out: out}
+	r.lines = &plainReader{in: reader, out: out}
+	r.reset()
+	return r
+}
+
+// reset : replaces the runtime with a fresh one. The runtime shares the
+// REPL's reader, so that readLine() sees the lines typed after the statement
+// calling it.
+func (r *repl) reset() {
+	r.config.Stdin, r.config.Stdout = r.reader, r.out
+	r.rt = colinterp.NewRuntime(r.config)
+}
+
+func (r *repl) run() {
+	fmt.Fprintln(r.out, "COLON v1.0.0")
 	for {
-		fmt.Print(prompt)
-		input, _ = reader.ReadString('\n')
+		input, err := r.readInput()
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil && input == "" {
+			return
+		}
 		if strings.TrimSpace(input) == "q:" {
-			break
+			return
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		if !r.runMetaCommand(strings.TrimSpace(input)) {
+			r.evaluate(input)
+		}
+	}
+}
+
+// readInput : reads lines until they form an input with no unfinished blocks
+func (r *repl) readInput() (string, error) {
+	input := ""
+	p := prompt
+	for {
+		line, err := r.lines.readLine(p)
+		if ed, ok := r.lines.(*lineEditor); ok && err == nil {
+			ed.history.add(line)
+		}
+		if err != nil {
+			return input + line, err
 		}
-		lexer := lex.CreateLexerState(input)
-		tokens := lexer.Lex()
-		// @DEBUG
-		// for _, t := range tokens {
-		// 	fmt.Printf("%s\t%s\t%d\n", t.TokType.String(), t.Literal, t.Line)
-		// }
-		// fmt.Println()
-		parser := par.CreateParserState(tokens, lexer.SourceLines())
+		input += line + "\n"
+		if strings.HasPrefix(strings.TrimSpace(input), ":") || openBlocks(input) <= 0 {
+			return input, nil
+		}
+		p = contPrompt
+	}
+}
 
-		// @DEBUG
-		parser.Parse()
-		// fmt.Println(temp.Statements)
-		// // parser.Parse(true)
+func (r *repl) evaluate(code string) {
+	r.evaluateFile("", code)
+}
 
-		fmt.Println(parser.ReportErrors())
+// evaluateFile : evaluates code read from the named file, printing its value
+func (r *repl) evaluateFile(filename string, code string) {
+	result, err := r.rt.RunFile(filename, code)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	if result.ObType() != obj.EMPTY {
+		fmt.Fprintln(r.out, result.ObValue())
+	}
+}
+
+// runMetaCommand : runs input if it is a meta-command, returning false if it is not one
+func (r *repl) runMetaCommand(input string) bool {
+	command, arg := input, ""
+	if i := strings.IndexAny(input, " \t"); i >= 0 {
+		command, arg = input[:i], strings.TrimSpace(input[i+1:])
+	}
+	switch command {
+	case ":env":
+		for _, name := range r.rt.Env().Names() {
+			val, _ := r.rt.Lookup(name)
+			switch val.ObType() {
+			case obj.FUNCTION, obj.BUILTIN:
+				fmt.Fprintf(r.out, "%s : %s\n", name, val.ObType())
+			default:
+				fmt.Fprintf(r.out, "%s : %s = %s\n", name, val.ObType(), val.ObValue())
+			}
+		}
+	case ":type":
+		result, err := r.rt.Run(arg)
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			return true
+		}
+		fmt.Fprintln(r.out, result.ObType())
+	case ":ast":
+		program, err := colinterp.Parse(arg)
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			return true
+		}
+		dumpNode(r.out, "", reflect.ValueOf(program), 0)
+	case ":tokens":
+		lexer := lex.CreateLexerState(arg)
+		for _, t := range lexer.Lex() {
+			fmt.Fprintf(r.out, "%d:%d\t%s\t%q\n", t.Line+1, t.Column+1, t.TokType.String(), t.Literal)
+		}
+		for _, e := range lexer.Errors() {
+			fmt.Fprintln(r.out, e)
+		}
+	case ":load":
+		code, err := ioutil.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintln(r.out, "Error reading file : "+arg)
+			return true
+		}
+		r.evaluateFile(arg, string(code))
+	case ":reset":
+		r.reset()
+	case ":help":
+		for _, c := range metaCommands {
+			fmt.Fprintf(r.out, "%-16s %s\n", c[0], c[1])
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// complete : the identifiers in scope that start with prefix
+func (r *repl) complete(prefix string) []string {
+	return completions(prefix, r.rt.Env().Names(), r.rt.BuiltinNames())
+}
+
+// dumpNode : prints a syntax tree node, one line per node, with its position
+// and literal fields, followed by its children indented underneath it
+func dumpNode(out io.Writer, label string, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		fmt.Fprintf(out, "%s%s<nil>\n", indent, label)
+		return
+	}
+	v = reflect.Indirect(v)
+	line := indent + label + v.Type().Name()
+	children := []int{}
+	for k := 0; k < v.NumField(); k++ {
+		field := v.Field(k)
+		switch value := field.Interface().(type) {
+		case tok.Token:
+			line += fmt.Sprintf(" [%d:%d]", value.Line+1, value.Column+1)
+		case string:
+			line += fmt.Sprintf(" %s=%q", v.Type().Field(k).Name, value)
+		case int64, float64, bool:
+			line += fmt.Sprintf(" %s=%v", v.Type().Field(k).Name, value)
+		default:
+			if holdsNodes(field.Type()) {
+				children = append(children, k)
+			}
+		}
+	}
+	fmt.Fprintln(out, line)
+	for _, k := range children {
+		name := v.Type().Field(k).Name
+		field := v.Field(k)
+		if field.Kind() == reflect.Slice {
+			for i := 0; i < field.Len(); i++ {
+				dumpNode(out, fmt.Sprintf("%s[%d]: ", name, i), field.Index(i), depth+1)
+			}
+			continue
+		}
+		dumpNode(out, name+": ", field, depth+1)
+	}
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// holdsNodes : whether a field of type t holds a node or a slice of nodes,
+// rather than something else kept alongside them, like the source lines
+func holdsNodes(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Implements(nodeType)
+}
+
+// openBlocks : counts the blocks in src that are opened but not yet closed
+func openBlocks(src string) int {
+	if src == "" {
+		return 0
+	}
+	depth := 0
+	for _, t := range lex.CreateLexerState(src).Lex() {
+		switch t.TokType {
+		case tok.FNB, tok.LPB, tok.IFB, tok.ELB, tok.TRB, tok.CTB:
+			depth++
+		case tok.FNE, tok.LPE, tok.IFE, tok.ELE, tok.TRE, tok.CTE:
+			depth--
+		}
 	}
+	return depth
 }
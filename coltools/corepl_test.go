@@ -0,0 +1,84 @@
+package coltools
+
+import (
+	"strings"
+	"testing"
+)
+
+func runRepl(input string) string {
+	var out strings.Builder
+	RunRepl(strings.NewReader(input), &out)
+	return out.String()
+}
+
+func TestReplKeepsState(t *testing.T) {
+	out := runRepl("v: a = 20\na + 22\nprint(nope)\na\nq:\nprint(1)\n")
+	want := "COLON v1.0.0\n" + prompt + prompt + "42\n" + prompt
+	if !strings.HasPrefix(out, want) {
+		t.Fatalf("got %q, want it to start with %q", out, want)
+	}
+	rest := strings.TrimPrefix(out, want)
+	if !strings.Contains(rest, "nope") || !strings.HasSuffix(rest, prompt+"20\n"+prompt) {
+		t.Errorf("after the error : got %q", rest)
+	}
+}
+
+func TestReplContinuesBlocks(t *testing.T) {
+	out := runRepl("v: g = f(x):\ni(x > 1):\nr: x\n:i\nr: 0\n:f\ng(5)\n")
+	if strings.Count(out, contPrompt) != 5 {
+		t.Errorf("got %d continuation prompts, want 5 : %q", strings.Count(out, contPrompt), out)
+	}
+	if !strings.HasSuffix(out, "5\n"+prompt) {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestReplInputReadsFollowingLines(t *testing.T) {
+	out := runRepl("v: n = readInt()\n7\nn * 6\n")
+	if !strings.Contains(out, "42\n") {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestReplMetaCommands(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"v: a = 1\n:env\n", []string{"a : INTEGER = 1\n"}},
+		{":type 1.5\n", []string{"FLOATING\n"}},
+		{":type nope\n", []string{"nope"}},
+		{":tokens v: a = 1\n", []string{"1:1\tVARIABLE\t\"v\"\n", "1:8\tINTEGER\t\"1\"\n"}},
+		{":ast v: a = 1 + 2\n", []string{"Program\n", "VarStatement [1:1]", "InfixExpression [1:10] Operator=\"+\"", "RightExpression: IntegerLiteral [1:12] Value=2"}},
+		{":ast print(\n", []string{"Error on line"}},
+		{"v: a = 1\n:reset\na\n", []string{"Runtime Error"}},
+		{":load /does/not/exist.col\n", []string{"Error reading file : /does/not/exist.col"}},
+		{":help\n", []string{":reset", "discard all bindings"}},
+	}
+	for _, tt := range tests {
+		out := runRepl(tt.input)
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%q : %q is missing from %q", tt.input, want, out)
+			}
+		}
+	}
+}
+
+func TestOpenBlocks(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{"", 0},
+		{"print(1)\n", 0},
+		{"v: g = f(x):\n", 1},
+		{"l(a < 1):\ni(a):\n", 2},
+		{"i(a):\nprint(1)\n:i\n", 0},
+	}
+	for _, tt := range tests {
+		if got := openBlocks(tt.src); got != tt.want {
+			t.Errorf("%q : got %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package coltools
+
+import "syscall"
+
+const (
+	ioctlReadTermios  = syscall.TCGETS
+	ioctlWriteTermios = syscall.TCSETS
+)
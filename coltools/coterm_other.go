@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package coltools
+
+import "errors"
+
+// termState : unused on platforms without raw mode support
+type termState struct{}
+
+// makeRaw : raw mode is not supported on this platform, so the REPL falls
+// back to reading whole lines
+func makeRaw(fd uintptr) (*termState, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+func restoreTerm(fd uintptr, state *termState) error {
+	return nil
+}
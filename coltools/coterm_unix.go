@@ -0,0 +1,46 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package coltools
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// termState : the terminal settings to restore after raw mode
+type termState struct {
+	termios syscall.Termios
+}
+
+// makeRaw : puts the terminal behind fd into raw mode, so that keys are read
+// one at a time and not echoed. Fails if fd is not a terminal.
+func makeRaw(fd uintptr) (*termState, error) {
+	var old syscall.Termios
+	if err := ioctlTermios(fd, ioctlReadTermios, &old); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON | syscall.BRKINT | syscall.INPCK | syscall.ISTRIP
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, ioctlWriteTermios, &raw); err != nil {
+		return nil, err
+	}
+	return &termState{termios: old}, nil
+}
+
+// restoreTerm : puts the terminal back into the state saved by makeRaw
+func restoreTerm(fd uintptr, state *termState) error {
+	return ioctlTermios(fd, ioctlWriteTermios, &state.termios)
+}
+
+func ioctlTermios(fd uintptr, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package colvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions : bytecode. Every instruction is an opcode byte followed by
+// its operands, stored big-endian with the widths given by its Definition.
+type Instructions []byte
+
+// Opcode : the first byte of an instruction
+type Opcode byte
+
+// opcodes understood by the VM. "top" is the value on top of the stack.
+const (
+	OpConstant Opcode = iota // push a constant
+	OpTrue                   // push true
+	OpFalse                  // push false
+	OpEmpty                  // push the empty value
+	OpPop                    // discard top
+	OpKeep                   // replace the value under top with top
+
+	OpAdd // infix operators, applied to the two values on top
+	OpSub
+	OpMul
+	OpDiv
+	OpRem
+	OpPow
+	OpEql
+	OpNeq
+	OpGrt
+	OpLst
+	OpGte
+	OpLse
+	OpAnd
+	OpOr
+	OpMinus // prefix operators, applied to top
+	OpNot
+
+	OpJump        // jump to an address
+	OpJumpNotTrue // pop a condition and jump to an address if it is false
+
+	OpGetName  // push the value of a name
+	OpDeclare  // pop a value and declare a name with it, as v: does
+	OpReassign // pop a value and rebind the nearest binding of a name
+	OpBind     // pop a value and bind a name to it in the current scope
+
+	OpList     // pop n values and push a list of them
+	OpMap      // pop n key-value pairs and push a map of them
+	OpIndex    // pop an index and a container and push the element
+	OpSetIndex // pop a value, an index and a container and store the element
+	OpMember   // pop a module and push the value it binds a name to
+
+	OpFunction // push a function defined in the current env
+	OpCall     // call the function under n arguments
+	OpReturn   // return top from the current function
+
+	OpIter     // pop a collection and push an iterator over it
+	OpIterNext // push the next key and value of the iterator under top, or jump when done
+
+	OpTry    // start handling runtime errors by jumping to an address
+	OpEndTry // stop handling runtime errors
+
+	OpImport // import the module at a path and declare a name with it
+)
+
+// Definition : the name and operand widths of an opcode
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpEmpty:    {"OpEmpty", []int{}},
+	OpPop:      {"OpPop", []int{}},
+	OpKeep:     {"OpKeep", []int{}},
+
+	OpAdd:   {"OpAdd", []int{}},
+	OpSub:   {"OpSub", []int{}},
+	OpMul:   {"OpMul", []int{}},
+	OpDiv:   {"OpDiv", []int{}},
+	OpRem:   {"OpRem", []int{}},
+	OpPow:   {"OpPow", []int{}},
+	OpEql:   {"OpEql", []int{}},
+	OpNeq:   {"OpNeq", []int{}},
+	OpGrt:   {"OpGrt", []int{}},
+	OpLst:   {"OpLst", []int{}},
+	OpGte:   {"OpGte", []int{}},
+	OpLse:   {"OpLse", []int{}},
+	OpAnd:   {"OpAnd", []int{}},
+	OpOr:    {"OpOr", []int{}},
+	OpMinus: {"OpMinus", []int{}},
+	OpNot:   {"OpNot", []int{}},
+
+	OpJump:        {"OpJump", []int{4}},        // address
+	OpJumpNotTrue: {"OpJumpNotTrue", []int{4}}, // address
+
+	OpGetName:  {"OpGetName", []int{2}},  // name
+	OpDeclare:  {"OpDeclare", []int{2}},  // name
+	OpReassign: {"OpReassign", []int{2}}, // name
+	OpBind:     {"OpBind", []int{2}},     // name
+
+	OpList:     {"OpList", []int{2}}, // number of elements
+	OpMap:      {"OpMap", []int{2}},  // number of pairs
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+	OpMember:   {"OpMember", []int{2}}, // name
+
+	OpFunction: {"OpFunction", []int{2}},   // function
+	OpCall:     {"OpCall", []int{2, 2, 1}}, // number of arguments, name of the callee, whether the callee is a name
+	OpReturn:   {"OpReturn", []int{}},
+
+	OpIter:     {"OpIter", []int{1}},        // whether keys are wanted
+	OpIterNext: {"OpIterNext", []int{4, 1}}, // address, whether keys are wanted
+
+	OpTry:    {"OpTry", []int{4}}, // address
+	OpEndTry: {"OpEndTry", []int{}},
+
+	OpImport: {"OpImport", []int{2, 2}}, // constant holding the path, name
+}
+
+// Lookup : the definition of an opcode
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make : assembles an instruction from an opcode and its operands
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+	offset := 1
+	for k, o := range operands {
+		switch def.OperandWidths[k] {
+		case 1:
+			instruction[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		}
+		offset += def.OperandWidths[k]
+	}
+	return instruction
+}
+
+// ReadOperands : decodes the operands of an instruction, returning them and
+// the number of bytes they take
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for k, w := range def.OperandWidths {
+		switch w {
+		case 1:
+			operands[k] = int(ins[offset])
+		case 2:
+			operands[k] = int(readUint16(ins[offset:]))
+		case 4:
+			operands[k] = int(readUint32(ins[offset:]))
+		}
+		offset += w
+	}
+	return operands, offset
+}
+
+func readUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func readUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
+// String : disassembles the instructions, one per line
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	for k := 0; k < len(ins); {
+		def, err := Lookup(ins[k])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			k++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[k+1:])
+		fmt.Fprintf(&out, "%04d %s", k, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&out, " %d", o)
+		}
+		out.WriteString("\n")
+		k += 1 + read
+	}
+	return out.String()
+}
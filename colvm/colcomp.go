@@ -0,0 +1,418 @@
+package colvm
+
+import (
+	ast "colon/colast"
+	obj "colon/colobj"
+	tok "colon/coltok"
+	"fmt"
+	"sort"
+)
+
+// CompiledFunction : the bytecode of a program or of a function body, with
+// the values its instructions refer to by index
+type CompiledFunction struct {
+	Name         string
+	Instructions Instructions
+	Constants    []obj.Object
+	Names        []string
+	Functions    []*ast.FunctionExpression
+	Positions    []Position // sorted by offset
+	Lines        []string   // the source the code was compiled from, for error messages
+}
+
+// Position : the source position of the instructions starting at Offset,
+// up to the next Position
+type Position struct {
+	Offset int
+	Pos    tok.Position
+}
+
+// positionAt : the source position of the instruction at an offset
+func (cf *CompiledFunction) positionAt(offset int) tok.Position {
+	k := sort.Search(len(cf.Positions), func(k int) bool {
+		return cf.Positions[k].Offset > offset
+	})
+	if k == 0 {
+		return tok.Position{}
+	}
+	return cf.Positions[k-1].Pos
+}
+
+// maximum index of a constant, name or function in a CompiledFunction
+const maxIndex = 1<<16 - 1
+
+// the opcodes of the infix operators
+var infixOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpRem,
+	"^":  OpPow,
+	"==": OpEql,
+	"!=": OpNeq,
+	">":  OpGrt,
+	"<":  OpLst,
+	">=": OpGte,
+	"<=": OpLse,
+	"&":  OpAnd,
+	"|":  OpOr,
+}
+
+// loop : the jumps out of a loop being compiled, patched once the loop's
+// addresses are known
+type loop struct {
+	breaks    []int
+	continues []int
+	tryDepth  int // tries around the loop, which break and continue stay in
+}
+
+// Compiler : compiles the syntax tree of a program, or of a function body,
+// into a CompiledFunction. Every statement leaves its value on the stack,
+// the way the tree-walking evaluator returns it, and blocks pop all but the
+// value of their last statement.
+type Compiler struct {
+	unit      *CompiledFunction
+	functions map[*ast.Block]*CompiledFunction // shared by all compilers of a program
+	names     map[string]int
+	loops     []*loop
+	tryDepth  int
+	err       error
+}
+
+// NewCompiler : creates a compiler that adds the bodies of the functions it
+// compiles to functions
+func NewCompiler(functions map[*ast.Block]*CompiledFunction) *Compiler {
+	return &Compiler{
+		unit:      &CompiledFunction{},
+		functions: functions,
+		names:     map[string]int{},
+	}
+}
+
+// Compile : compiles a program. Its value is the value of the last statement,
+// or the value of the first top-level r: reached.
+func (c *Compiler) Compile(program *ast.Program) (*CompiledFunction, error) {
+	c.unit.Lines = program.Lines
+	c.compileStatements(program.Statements, program.Pos())
+	c.emit(program.Pos(), OpReturn)
+	return c.unit, c.err
+}
+
+// CompileFunction : compiles the body of a function, defined in the given
+// source lines
+func (c *Compiler) CompileFunction(name string, body *ast.Block, lines []string) (*CompiledFunction, error) {
+	c.unit.Name = name
+	c.unit.Lines = lines
+	c.functions[body] = c.unit
+	c.compileStatements(body.Statements, body.Pos())
+	c.emit(body.Pos(), OpReturn)
+	return c.unit, c.err
+}
+
+func (c *Compiler) compileStatements(statements []ast.Statement, pos tok.Position) {
+	if len(statements) == 0 {
+		c.emit(pos, OpEmpty)
+		return
+	}
+	for k, statement := range statements {
+		c.compileNode(statement)
+		if k < len(statements)-1 {
+			c.emit(statement.Pos(), OpPop)
+		}
+	}
+}
+
+func (c *Compiler) compileNode(node ast.Node) {
+	pos := node.Pos()
+	switch node := node.(type) {
+
+	case *ast.ExpressionStatement:
+		c.compileNode(node.Expression)
+
+	case *ast.VarStatement:
+		c.compileNode(node.Value)
+		c.emit(pos, OpDeclare, c.name(node.Name.Value))
+		c.emit(pos, OpEmpty)
+
+	case *ast.ImportStatement:
+		c.emit(pos, OpImport, c.constant(&obj.String{Value: node.Path}), c.name(node.Name.Value))
+		c.emit(pos, OpEmpty)
+
+	case *ast.AssignStatement:
+		if name, ok := node.Target.(*ast.Identifier); ok {
+			c.compileNode(node.Value)
+			c.emit(pos, OpReassign, c.name(name.Value))
+		} else {
+			target := node.Target.(*ast.ArrayIndexExpression)
+			c.compileNode(target.LeftExpression)
+			c.compileNode(target.Index)
+			c.compileNode(node.Value)
+			c.emit(pos, OpSetIndex)
+		}
+		c.emit(pos, OpEmpty)
+
+	case *ast.ReturnStatement:
+		c.compileNode(node.ReturnValue)
+		c.emit(pos, OpReturn)
+
+	case *ast.BreakStatement:
+		l := c.loops[len(c.loops)-1]
+		c.leaveTries(pos, l)
+		c.emit(pos, OpEmpty)
+		c.emit(pos, OpKeep)
+		l.breaks = append(l.breaks, c.emit(pos, OpJump, 0))
+
+	case *ast.ContinueStatement:
+		l := c.loops[len(c.loops)-1]
+		c.leaveTries(pos, l)
+		c.emit(pos, OpEmpty)
+		c.emit(pos, OpKeep)
+		l.continues = append(l.continues, c.emit(pos, OpJump, 0))
+
+	case *ast.Identifier:
+		c.emit(pos, OpGetName, c.name(node.Value))
+
+	case *ast.IntegerLiteral:
+		c.emit(pos, OpConstant, c.constant(&obj.Integer{Value: node.Value}))
+
+	case *ast.FloatingLiteral:
+		c.emit(pos, OpConstant, c.constant(&obj.Floating{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(pos, OpConstant, c.constant(&obj.String{Value: node.Value}))
+
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(pos, OpTrue)
+		} else {
+			c.emit(pos, OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		c.compileNode(node.RightExpression)
+		switch node.Operator {
+		case "-":
+			c.emit(pos, OpMinus)
+		case "!":
+			c.emit(pos, OpNot)
+		default:
+			c.fail(pos, fmt.Sprintf("unknown prefix operator %q", node.Operator))
+		}
+
+	case *ast.InfixExpression:
+		c.compileNode(node.LeftExpression)
+		c.compileNode(node.RightExpression)
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			c.fail(pos, fmt.Sprintf("unknown infix operator %q", node.Operator))
+		}
+		c.emit(pos, op)
+
+	case *ast.Block:
+		c.compileStatements(node.Statements, pos)
+
+	case *ast.IfExpression:
+		c.compileNode(node.Condition)
+		jumpToElse := c.emit(pos, OpJumpNotTrue, 0)
+		c.compileNode(node.IfBody)
+		jumpToEnd := c.emit(pos, OpJump, 0)
+		c.patch(jumpToElse, c.here())
+		if node.ElseBody != nil {
+			c.compileNode(node.ElseBody)
+		} else {
+			c.emit(pos, OpEmpty)
+		}
+		c.patch(jumpToEnd, c.here())
+
+	case *ast.LoopExpression:
+		// the loop's value sits under the body, replaced after every iteration
+		c.emit(pos, OpEmpty)
+		start := c.here()
+		c.compileNode(node.Condition)
+		exit := c.emit(pos, OpJumpNotTrue, 0)
+		l := c.enterLoop()
+		c.compileNode(node.LoopBody)
+		c.emit(pos, OpKeep)
+		c.emit(pos, OpJump, start)
+		c.exitLoop(l, start)
+		end := c.here()
+		c.patch(exit, end)
+		for _, b := range l.breaks {
+			c.patch(b, end)
+		}
+
+	case *ast.ForEachExpression:
+		// the iterator sits under the loop's value while the loop runs
+		withKey := 0
+		if node.Key != nil {
+			withKey = 1
+		}
+		c.compileNode(node.Collection)
+		c.emit(pos, OpIter, withKey)
+		c.emit(pos, OpEmpty)
+		next := c.here()
+		exit := c.emit(pos, OpIterNext, 0, withKey)
+		if node.Key != nil {
+			c.emit(pos, OpBind, c.name(node.Key.Value))
+		}
+		c.emit(pos, OpBind, c.name(node.Value.Value))
+		l := c.enterLoop()
+		c.compileNode(node.LoopBody)
+		c.emit(pos, OpKeep)
+		c.emit(pos, OpJump, next)
+		c.exitLoop(l, next)
+		end := c.here()
+		c.emit(pos, OpKeep) // drops the iterator
+		c.patch(exit, end)
+		for _, b := range l.breaks {
+			c.patch(b, end)
+		}
+
+	case *ast.TryExpression:
+		try := c.emit(pos, OpTry, 0)
+		c.tryDepth++
+		c.compileNode(node.TryBody)
+		c.tryDepth--
+		c.emit(pos, OpEndTry)
+		jumpToEnd := c.emit(pos, OpJump, 0)
+		c.patch(try, c.here())
+		c.emit(pos, OpBind, c.name(node.ErrName.Value))
+		c.compileNode(node.CatchBody)
+		c.patch(jumpToEnd, c.here())
+
+	case *ast.FunctionExpression:
+		if _, ok := c.functions[node.FuncBody]; !ok {
+			if _, err := NewCompiler(c.functions).CompileFunction("", node.FuncBody, c.unit.Lines); err != nil && c.err == nil {
+				c.err = err
+			}
+		}
+		c.emit(pos, OpFunction, c.function(node))
+
+	case *ast.FunctionCallExpression:
+		c.compileNode(node.Function)
+		for _, arg := range node.Arguments {
+			c.compileNode(arg)
+		}
+		named := 0
+		switch node.Function.(type) {
+		case *ast.Identifier, *ast.MemberExpression:
+			named = 1
+		}
+		c.emit(pos, OpCall, len(node.Arguments), c.name(node.Function.String()), named)
+
+	case *ast.Array:
+		for _, elem := range node.Elements {
+			c.compileNode(elem)
+		}
+		c.emit(pos, OpList, len(node.Elements))
+
+	case *ast.Map:
+		for k := range node.Keys {
+			c.compileNode(node.Keys[k])
+			c.compileNode(node.Values[k])
+		}
+		c.emit(pos, OpMap, len(node.Keys))
+
+	case *ast.ArrayIndexExpression:
+		c.compileNode(node.LeftExpression)
+		c.compileNode(node.Index)
+		c.emit(pos, OpIndex)
+
+	case *ast.MemberExpression:
+		c.compileNode(node.LeftExpression)
+		c.emit(pos, OpMember, c.name(node.Member.Value))
+
+	default:
+		c.fail(pos, fmt.Sprintf("cannot compile %T", node))
+	}
+}
+
+// emit : appends an instruction, returning its offset. Operands that do not
+// fit in their width, like the count of a call with too many arguments, fail
+// the compilation rather than being cut short.
+func (c *Compiler) emit(pos tok.Position, op Opcode, operands ...int) int {
+	for k, w := range definitions[op].OperandWidths {
+		if operands[k] < 0 || operands[k] >= 1<<(8*uint(w)) {
+			c.fail(pos, fmt.Sprintf("too large to compile : operand %d of %s is %d, and at most %d fits", k+1, definitions[op].Name, operands[k], 1<<(8*uint(w))-1))
+		}
+	}
+	offset := len(c.unit.Instructions)
+	positions := c.unit.Positions
+	if len(positions) == 0 || positions[len(positions)-1].Pos != pos {
+		c.unit.Positions = append(positions, Position{Offset: offset, Pos: pos})
+	}
+	c.unit.Instructions = append(c.unit.Instructions, Make(op, operands...)...)
+	return offset
+}
+
+// here : the offset of the next instruction
+func (c *Compiler) here() int {
+	return len(c.unit.Instructions)
+}
+
+// patch : sets the address of the jump at offset
+func (c *Compiler) patch(offset int, address int) {
+	c.patchOperand(offset, 0, address)
+}
+
+// patchOperand : sets an operand of the instruction at offset
+func (c *Compiler) patchOperand(offset int, operand int, value int) {
+	op := Opcode(c.unit.Instructions[offset])
+	operands, _ := ReadOperands(definitions[op], c.unit.Instructions[offset+1:])
+	operands[operand] = value
+	copy(c.unit.Instructions[offset:], Make(op, operands...))
+}
+
+func (c *Compiler) enterLoop() *loop {
+	l := &loop{tryDepth: c.tryDepth}
+	c.loops = append(c.loops, l)
+	return l
+}
+
+func (c *Compiler) exitLoop(l *loop, next int) {
+	c.loops = c.loops[:len(c.loops)-1]
+	for _, cont := range l.continues {
+		c.patch(cont, next)
+	}
+}
+
+// leaveTries : ends the tries a break or continue jumps out of
+func (c *Compiler) leaveTries(pos tok.Position, l *loop) {
+	for k := l.tryDepth; k < c.tryDepth; k++ {
+		c.emit(pos, OpEndTry)
+	}
+}
+
+func (c *Compiler) constant(o obj.Object) int {
+	c.unit.Constants = append(c.unit.Constants, o)
+	return c.index(len(c.unit.Constants) - 1)
+}
+
+func (c *Compiler) name(name string) int {
+	if k, ok := c.names[name]; ok {
+		return k
+	}
+	c.unit.Names = append(c.unit.Names, name)
+	c.names[name] = c.index(len(c.unit.Names) - 1)
+	return c.names[name]
+}
+
+func (c *Compiler) function(node *ast.FunctionExpression) int {
+	c.unit.Functions = append(c.unit.Functions, node)
+	return c.index(len(c.unit.Functions) - 1)
+}
+
+// index : checks that an index fits in an operand
+func (c *Compiler) index(k int) int {
+	if k > maxIndex && c.err == nil {
+		c.err = fmt.Errorf("too many constants, names or functions in one function to compile")
+	}
+	return k
+}
+
+func (c *Compiler) fail(pos tok.Position, msg string) {
+	if c.err == nil {
+		c.err = fmt.Errorf("line %d, column %d : %s", pos.Line+1, pos.Column+1, msg)
+	}
+}
@@ -0,0 +1,499 @@
+package colvm
+
+import (
+	ast "colon/colast"
+	evl "colon/coleval"
+	obj "colon/colobj"
+	"fmt"
+)
+
+// The VM runs compiled programs with the semantics of the tree-walking
+// evaluator in coleval, which it shares its builtins, input and output with.
+// Names are looked up in the same envs, so functions, closures and scoping
+// behave the same, and a program may use functions defined by the other.
+
+// the largest number of nested calls before the VM gives up, as for the evaluator
+const maxFrames = evl.MaxCallDepth
+
+// small integers are preallocated, so that arithmetic on them, like loop
+// counters, does not allocate
+const (
+	smallIntMin = -128
+	smallIntMax = 1024
+)
+
+var smallInts = func() []*obj.Integer {
+	ints := make([]*obj.Integer, smallIntMax-smallIntMin+1)
+	for k := range ints {
+		ints[k] = &obj.Integer{Value: int64(k + smallIntMin)}
+	}
+	return ints
+}()
+
+// the same objects as the evaluator's, so that results of either engine
+// can be compared with those of the other and of the host
+var (
+	booleanTrue  = obj.TrueObject
+	booleanFalse = obj.FalseObject
+)
+
+// the operators applied by the opcodes, for values handled by coleval
+var opcodeOperators = map[Opcode]string{
+	OpAdd: "+", OpSub: "-", OpMul: "*", OpDiv: "/", OpRem: "%", OpPow: "^",
+	OpEql: "==", OpNeq: "!=", OpGrt: ">", OpLst: "<", OpGte: ">=", OpLse: "<=",
+	OpAnd: "&", OpOr: "|", OpMinus: "-", OpNot: "!",
+}
+
+// frame : a running program or function
+type frame struct {
+	fn     *CompiledFunction
+	ip     int
+	base   int // the stack height when the frame was entered
+	env    *obj.Env
+	module *obj.Module // the module the code being run is in, nil for the program
+
+	// for calls to colon functions, what stack traces show
+	name   string
+	caller *CompiledFunction // nil for the program
+	callAt int               // offset of the call in caller
+	args   []obj.Object
+}
+
+// handler : a try whose catch runs when a runtime error happens in its frame
+// or in a function called from it
+type handler struct {
+	frame   int
+	sp      int
+	address int
+}
+
+// iterator : the state of a for-each loop
+type iterator struct {
+	keys, values []obj.Object
+	next         int
+}
+
+func (it *iterator) ObValue() string        { return "ITERATOR" }
+func (it *iterator) ObType() obj.ObjectType { return "ITERATOR" }
+
+// VM : a stack machine running compiled colon programs
+type VM struct {
+	ev        *evl.Evaluator
+	functions map[*ast.Block]*CompiledFunction
+	stack     []obj.Object
+	frames    []*frame
+	handlers  []handler
+	at        int // offset of the instruction being run
+
+	// the frame whose return ends the execute running: 0 for the program,
+	// or that of a function a builtin is calling through CallFunction.
+	// Errors are not caught by the tries of the frames below it, which wait
+	// for the builtin to return.
+	floor int
+}
+
+// New : creates a VM that calls builtins and reads and prints through ev
+func New(ev *evl.Evaluator) *VM {
+	return &VM{
+		ev:        ev,
+		functions: map[*ast.Block]*CompiledFunction{},
+	}
+}
+
+// Compile : compiles a program for this VM
+func (vm *VM) Compile(program *ast.Program) (*CompiledFunction, error) {
+	return NewCompiler(vm.functions).Compile(program)
+}
+
+// Run : runs a compiled program in env, returning its value. Runtime errors
+// are returned as a *coleval.RuntimeError, like coleval's Run does.
+func (vm *VM) Run(main *CompiledFunction, env *obj.Env) (obj.Object, error) {
+	return vm.run(&frame{fn: main, env: env})
+}
+
+// RunModule : like Run, for the top-level code of a module, which runs in
+// the module's env
+func (vm *VM) RunModule(main *CompiledFunction, module *obj.Module) (obj.Object, error) {
+	return vm.run(&frame{fn: main, env: module.Env, module: module})
+}
+
+func (vm *VM) run(main *frame) (obj.Object, error) {
+	vm.stack = vm.stack[:0]
+	vm.handlers = vm.handlers[:0]
+	vm.frames = []*frame{main}
+	vm.floor = 0
+	for {
+		result, done, err := vm.execute()
+		if done {
+			return result, err
+		}
+	}
+}
+
+// execute : runs until the program returns or a runtime error happens. A
+// runtime error inside a try is handled by moving to its catch, and done is
+// false so that the run can be resumed from there.
+func (vm *VM) execute() (result obj.Object, done bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rerr := evl.AsRuntimeError(r)
+			vm.locate(rerr)
+			if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frame < vm.floor {
+				result, done, err = nil, true, rerr
+				return
+			}
+			vm.catch(rerr)
+			result, done, err = nil, false, nil
+		}
+	}()
+
+	fr := vm.frames[len(vm.frames)-1]
+	for {
+		ins := fr.fn.Instructions
+		vm.at = fr.ip
+		op := Opcode(ins[fr.ip])
+		fr.ip++
+
+		switch op {
+		case OpConstant:
+			vm.push(fr.fn.Constants[readUint16(ins[fr.ip:])])
+			fr.ip += 2
+
+		case OpTrue:
+			vm.push(booleanTrue)
+
+		case OpFalse:
+			vm.push(booleanFalse)
+
+		case OpEmpty:
+			vm.push(evl.EMPTY)
+
+		case OpPop:
+			vm.pop()
+
+		case OpKeep:
+			top := vm.pop()
+			vm.stack[len(vm.stack)-1] = top
+
+		case OpAdd, OpSub, OpMul, OpDiv, OpRem, OpPow, OpEql, OpNeq, OpGrt, OpLst, OpGte, OpLse, OpAnd, OpOr:
+			right := vm.pop()
+			left := vm.pop()
+			vm.push(vm.infix(op, left, right))
+
+		case OpMinus, OpNot:
+			vm.push(evl.PrefixOperation(opcodeOperators[op], vm.pop()))
+
+		case OpJump:
+			fr.ip = int(readUint32(ins[fr.ip:]))
+
+		case OpJumpNotTrue:
+			if evl.Condition(vm.pop()) {
+				fr.ip += 4
+			} else {
+				fr.ip = int(readUint32(ins[fr.ip:]))
+			}
+
+		case OpGetName:
+			vm.push(vm.ev.Resolve(fr.fn.Names[readUint16(ins[fr.ip:])], fr.env))
+			fr.ip += 2
+
+		case OpDeclare:
+			evl.Declare(fr.env, fr.fn.Names[readUint16(ins[fr.ip:])], vm.pop())
+			fr.ip += 2
+
+		case OpReassign:
+			evl.Reassign(fr.env, fr.fn.Names[readUint16(ins[fr.ip:])], vm.pop())
+			fr.ip += 2
+
+		case OpBind:
+			fr.env.Set(fr.fn.Names[readUint16(ins[fr.ip:])], vm.pop())
+			fr.ip += 2
+
+		case OpList:
+			n := int(readUint16(ins[fr.ip:]))
+			fr.ip += 2
+			elements := make([]obj.Object, n)
+			copy(elements, vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(&obj.List{Elements: elements})
+
+		case OpMap:
+			n := int(readUint16(ins[fr.ip:]))
+			fr.ip += 2
+			pairs := vm.stack[len(vm.stack)-2*n:]
+			m := obj.NewMap()
+			for k := 0; k < n; k++ {
+				m.Set(evl.HashKey(pairs[2*k]), pairs[2*k+1])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*n]
+			vm.push(m)
+
+		case OpIndex:
+			index := vm.pop()
+			vm.push(evl.IndexOperation(vm.pop(), index))
+
+		case OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			evl.AssignElement(vm.pop(), index, value)
+
+		case OpMember:
+			vm.push(evl.MemberOperation(vm.pop(), fr.fn.Names[readUint16(ins[fr.ip:])]))
+			fr.ip += 2
+
+		case OpFunction:
+			node := fr.fn.Functions[readUint16(ins[fr.ip:])]
+			fr.ip += 2
+			vm.push(&obj.Function{Parameters: node.Params, FuncBody: node.FuncBody, Env: fr.env, Module: fr.module, Lines: fr.fn.Lines})
+
+		case OpCall:
+			n := int(readUint16(ins[fr.ip:]))
+			name := fr.fn.Names[readUint16(ins[fr.ip+2:])]
+			named := ins[fr.ip+4] == 1
+			fr.ip += 5
+			fr = vm.call(fr, n, name, named)
+
+		case OpReturn:
+			result := vm.pop()
+			depth := len(vm.frames) - 1
+			for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= depth {
+				vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			}
+			if depth == vm.floor {
+				if depth > 0 {
+					vm.stack = vm.stack[:fr.base]
+					vm.frames = vm.frames[:depth]
+				}
+				return result, true, nil
+			}
+			vm.stack = vm.stack[:fr.base]
+			vm.frames = vm.frames[:depth]
+			fr = vm.frames[depth-1]
+			vm.push(result)
+
+		case OpIter:
+			withKey := ins[fr.ip] == 1
+			fr.ip++
+			keys, values := evl.ForEachValues(vm.pop(), withKey)
+			vm.push(&iterator{keys: keys, values: values})
+
+		case OpIterNext:
+			it := vm.stack[len(vm.stack)-2].(*iterator)
+			if it.next >= len(it.values) {
+				fr.ip = int(readUint32(ins[fr.ip:]))
+				break
+			}
+			vm.push(it.values[it.next])
+			if ins[fr.ip+4] == 1 {
+				vm.push(it.keys[it.next])
+			}
+			it.next++
+			fr.ip += 5
+
+		case OpTry:
+			vm.handlers = append(vm.handlers, handler{
+				frame:   len(vm.frames) - 1,
+				sp:      len(vm.stack),
+				address: int(readUint32(ins[fr.ip:])),
+			})
+			fr.ip += 4
+
+		case OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case OpImport:
+			path := fr.fn.Constants[readUint16(ins[fr.ip:])].ObValue()
+			name := fr.fn.Names[readUint16(ins[fr.ip+2:])]
+			fr.ip += 4
+			evl.Declare(fr.env, name, vm.ev.Import(path, fr.module))
+
+		default:
+			panic(fmt.Errorf("unknown opcode %d", op))
+		}
+	}
+}
+
+// call : calls the function under n arguments on the stack. Colon functions
+// get a new frame, which is returned; anything else is called through the
+// evaluator and its result pushed.
+func (vm *VM) call(fr *frame, n int, callee string, named bool) *frame {
+	function := vm.stack[len(vm.stack)-1-n]
+	if function == evl.EMPTY {
+		evl.ReportError(fmt.Sprintf("function %q not found.", callee))
+	}
+	arguments := make([]obj.Object, n)
+	copy(arguments, vm.stack[len(vm.stack)-n:])
+	base := len(vm.stack) - 1 - n
+	vm.stack = vm.stack[:base]
+
+	funct, ok := function.(*obj.Function)
+	if !ok {
+		vm.push(vm.result(vm.ev.CallWith(function, arguments, vm)))
+		return fr
+	}
+	if len(arguments) != len(funct.Parameters) {
+		evl.ReportError(fmt.Sprintf("function takes %d argument(s), got %d", len(funct.Parameters), len(arguments)))
+	}
+	// the first frame runs the program, and is not a call
+	if len(vm.frames)-1 >= maxFrames {
+		evl.ReportError(fmt.Sprintf("too many nested calls (more than %d)", maxFrames))
+	}
+	env := obj.NewInnerEnv(funct.Env)
+	for k, param := range funct.Parameters {
+		env.Set(param.Value, arguments[k])
+	}
+	if !named {
+		callee = ""
+	}
+	callFrame := &frame{
+		fn:     vm.compiled(funct),
+		base:   base,
+		env:    env,
+		module: funct.Module,
+		name:   evl.CallName(callee, funct),
+		caller: fr.fn,
+		callAt: vm.at,
+		args:   arguments,
+	}
+	vm.frames = append(vm.frames, callFrame)
+	return callFrame
+}
+
+// CallFunction : runs a function that a builtin like map calls, on top of
+// the frames already running, and returns its result. A runtime error that
+// the function does not catch unwinds into the builtin, and out of it into
+// the frame that called the builtin.
+func (vm *VM) CallFunction(function obj.Object, args ...obj.Object) obj.Object {
+	if _, ok := function.(*obj.Function); !ok {
+		return vm.result(vm.ev.CallWith(function, args, vm))
+	}
+	floor, at, base := vm.floor, vm.at, len(vm.stack)
+	defer func() { vm.floor, vm.at = floor, at }()
+
+	vm.push(function)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.call(vm.frames[len(vm.frames)-1], len(args), "", false)
+	vm.floor = len(vm.frames) - 1
+	for {
+		result, done, err := vm.execute()
+		if !done {
+			continue
+		}
+		if err != nil {
+			vm.frames = vm.frames[:vm.floor]
+			vm.stack = vm.stack[:base]
+			panic(err)
+		}
+		return result
+	}
+}
+
+// compiled : the bytecode of a function's body, compiling it if it has not
+// been, as for functions made by the tree-walking evaluator
+func (vm *VM) compiled(funct *obj.Function) *CompiledFunction {
+	if cf, ok := vm.functions[funct.FuncBody]; ok {
+		return cf
+	}
+	cf, err := NewCompiler(vm.functions).CompileFunction(funct.Name, funct.FuncBody, funct.Lines)
+	if err != nil {
+		panic(err)
+	}
+	return cf
+}
+
+// infix : applies an infix operator, without allocating for the common
+// operations on small integers
+func (vm *VM) infix(op Opcode, left obj.Object, right obj.Object) obj.Object {
+	l, lok := left.(*obj.Integer)
+	r, rok := right.(*obj.Integer)
+	if lok && rok {
+		switch op {
+		case OpAdd:
+			return integer(l.Value + r.Value)
+		case OpSub:
+			return integer(l.Value - r.Value)
+		case OpMul:
+			return integer(l.Value * r.Value)
+		case OpEql:
+			return boolean(l.Value == r.Value)
+		case OpNeq:
+			return boolean(l.Value != r.Value)
+		case OpGrt:
+			return boolean(l.Value > r.Value)
+		case OpLst:
+			return boolean(l.Value < r.Value)
+		case OpGte:
+			return boolean(l.Value >= r.Value)
+		case OpLse:
+			return boolean(l.Value <= r.Value)
+		}
+	}
+	return evl.InfixOperation(opcodeOperators[op], left, right)
+}
+
+func integer(value int64) *obj.Integer {
+	if value >= smallIntMin && value <= smallIntMax {
+		return smallInts[value-smallIntMin]
+	}
+	return &obj.Integer{Value: value}
+}
+
+func boolean(value bool) *obj.Boolean {
+	if value {
+		return booleanTrue
+	}
+	return booleanFalse
+}
+
+// result : the value pushed for the result of a builtin
+func (vm *VM) result(o obj.Object) obj.Object {
+	if o == nil {
+		return evl.EMPTY
+	}
+	return o
+}
+
+func (vm *VM) push(o obj.Object) {
+	vm.stack = append(vm.stack, o)
+}
+
+func (vm *VM) pop() obj.Object {
+	o := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return o
+}
+
+// locate : gives a runtime error the position of the instruction it
+// happened in, and the calls leading to it
+func (vm *VM) locate(rerr *evl.RuntimeError) {
+	if rerr.Line != 0 {
+		return
+	}
+	fr := vm.frames[len(vm.frames)-1]
+	rerr.Locate(fr.fn.positionAt(vm.at), fr.module, fr.fn.Lines)
+	rerr.Trace = vm.stackTrace()
+}
+
+// stackTrace : the calls being run, innermost first
+func (vm *VM) stackTrace() []obj.Frame {
+	trace := []obj.Frame{}
+	for k := len(vm.frames) - 1; k > 0; k-- {
+		fr := vm.frames[k]
+		line := fr.caller.positionAt(fr.callAt).Line + 1
+		trace = append(trace, evl.DescribeCall(fr.name, line, fr.args))
+	}
+	return trace
+}
+
+// catch : unwinds to the innermost try and continues at its catch, with
+// the error on the stack
+func (vm *VM) catch(rerr *evl.RuntimeError) {
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.frames = vm.frames[:h.frame+1]
+	vm.stack = vm.stack[:h.sp]
+	vm.frames[h.frame].ip = h.address
+	vm.push(rerr.Value())
+}